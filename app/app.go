@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/rwx-yxu/greenlight/internal/brokers"
 	"github.com/rwx-yxu/greenlight/internal/jsonlog"
 	"github.com/rwx-yxu/greenlight/internal/mailer"
 	"github.com/rwx-yxu/greenlight/internal/services"
+	"github.com/rwx-yxu/greenlight/internal/storage"
+	"golang.org/x/text/language"
 )
 
 /*
@@ -29,6 +32,7 @@ type Config struct {
 		MaxOpenConns int    `yaml:"maxOpenConns"`
 		MaxIdleConns int    `yaml:"maxIdleConns"`
 		MaxIdleTime  string `yaml:"maxIdleTime"`
+		AutoMigrate  bool   `yaml:"autoMigrate"`
 	} `yaml:"db"`
 	Limiter struct {
 		RPS     float64 `yaml:"rps"`
@@ -46,6 +50,34 @@ type Config struct {
 		Origins        string `yaml:"origins"`
 		TrustedOrigins []string
 	} `yaml:"cors"`
+	Suggest struct {
+		Threshold float64 `yaml:"threshold"`
+		RateCost  int     `yaml:"rateCost"`
+	} `yaml:"suggest"`
+	Export struct {
+		Timeout         string        `yaml:"timeout"`
+		RateCost        int           `yaml:"rateCost"`
+		MaxConcurrent   int           `yaml:"maxConcurrent"`
+		TimeoutDuration time.Duration `yaml:"-"`
+	} `yaml:"export"`
+	Import struct {
+		Timeout         string        `yaml:"timeout"`
+		TimeoutDuration time.Duration `yaml:"-"`
+	} `yaml:"import"`
+	Storage struct {
+		Dir string `yaml:"dir"`
+	} `yaml:"storage"`
+	Images struct {
+		MaxUploadSize int64 `yaml:"maxUploadSize"`
+	} `yaml:"images"`
+	Titles struct {
+		OriginalLanguage string `yaml:"originalLanguage"`
+	} `yaml:"titles"`
+	Cache struct {
+		Enabled bool   `yaml:"enabled"`
+		Size    int    `yaml:"size"`
+		TTL     string `yaml:"ttl"`
+	} `yaml:"cache"`
 }
 
 type Services struct {
@@ -53,32 +85,196 @@ type Services struct {
 	User       services.UserReadWriter
 	Token      services.TokenWriteDeleter
 	Permission services.PermissionReadWriter
+	Role       services.RoleReadWriteDeleter
+	Rating     services.RatingWriteDeleter
+	Review     services.ReviewReadWriteDeleter
+	List       services.ListReadWriteDeleter
+	Person     services.PersonReadWriteDeleter
+	Credit     services.CreditReadWriteDeleter
+	Genre      services.GenreReadWriter
+	Image      services.ImageReadWriteDeleter
+	Collection services.CollectionReadWriteDeleter
+	Title      services.TitleReadWriteDeleter
 }
 
 type Application struct {
 	Config *Config
 	Logger *jsonlog.Logger
 	Services
-	SMTP mailer.Mailer
-	WG   sync.WaitGroup
+	Cache services.Cache
+	SMTP  mailer.Mailer
+	WG    sync.WaitGroup
+	// Exports holds a token for each export in progress. Every export keeps a
+	// database connection for as long as it runs, so they are capped to stop them
+	// using up the connection pool.
+	Exports chan struct{}
 }
 
-func NewApp(conf Config, db *sql.DB, log *jsonlog.Logger) *Application {
-	ms := services.NewMovie(brokers.NewMovie(db))
+// Defaults for the user-by-token and permissions cache. The cache is off unless
+// cache.enabled is set, because invalidation only reaches the cache of the replica
+// which made the change: with more than one replica, a revoked token or permission
+// change can take up to the TTL to be seen by the others. Only enable it for a
+// single replica, or where that delay is acceptable.
+const (
+	defaultCacheSize = 10_000
+	defaultCacheTTL  = 30 * time.Second
+
+	// defaultStorageDir is where uploaded files are kept if storage.dir isn't set.
+	defaultStorageDir = "data"
+
+	// defaultOriginalLanguage is the language original titles are taken to be in if
+	// titles.originalLanguage isn't set.
+	defaultOriginalLanguage = "en"
+
+	// defaultSuggestRateCost is how many tokens of the client's rate limit a
+	// suggestion uses if suggest.rateCost isn't set, since a trigram similarity
+	// search costs more than an ordinary request.
+	defaultSuggestRateCost = 2
+
+	// Defaults for exports. The timeout replaces the server's WriteTimeout for the
+	// export response only.
+	defaultExportTimeout       = 10 * time.Minute
+	defaultExportRateCost      = 5
+	defaultExportMaxConcurrent = 2
+
+	// defaultImportTimeout is how long an import may take if import.timeout isn't
+	// set. It replaces the server's ReadTimeout and WriteTimeout for the import
+	// request only.
+	defaultImportTimeout = 10 * time.Minute
+)
+
+// parseDuration parses the duration configured under key, returning def if it isn't
+// set.
+func parseDuration(key, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s: must be positive", key)
+	}
+	return d, nil
+}
+
+// rateCost returns the rate limit cost configured under key, or def if it isn't set.
+// A configured cost above the limiter's burst could never be allowed, so it is an
+// error, whereas the default is lowered to the burst.
+func rateCost(conf Config, key string, cost, def int) (int, error) {
+	if cost < 0 {
+		return 0, fmt.Errorf("%s: must not be negative", key)
+	}
+	burst := conf.Limiter.Burst
+	if cost == 0 {
+		cost = def
+		if conf.Limiter.Enabled && cost > burst && burst > 0 {
+			cost = burst
+		}
+	}
+	if conf.Limiter.Enabled && cost > burst {
+		return 0, fmt.Errorf("%s: must not be more than limiter.burst (%d)", key, burst)
+	}
+	return cost, nil
+}
+
+func NewApp(conf Config, db *sql.DB, log *jsonlog.Logger) (*Application, error) {
+	var err error
+	conf.Suggest.RateCost, err = rateCost(conf, "suggest.rateCost", conf.Suggest.RateCost, defaultSuggestRateCost)
+	if err != nil {
+		return nil, err
+	}
+	conf.Export.RateCost, err = rateCost(conf, "export.rateCost", conf.Export.RateCost, defaultExportRateCost)
+	if err != nil {
+		return nil, err
+	}
+	conf.Export.TimeoutDuration, err = parseDuration("export.timeout", conf.Export.Timeout, defaultExportTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conf.Import.TimeoutDuration, err = parseDuration("import.timeout", conf.Import.Timeout, defaultImportTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Export.MaxConcurrent <= 0 {
+		conf.Export.MaxConcurrent = defaultExportMaxConcurrent
+	}
+
+	dir := conf.Storage.Dir
+	if dir == "" {
+		dir = defaultStorageDir
+	}
+	store, err := storage.NewLocal(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	gb := brokers.NewGenre(db)
+	ms := services.NewMovie(brokers.NewMovie(db), gb)
 	us := services.NewUser(brokers.NewUser(db))
 	ts := services.NewToken(brokers.NewToken(db))
 	ps := services.NewPermission(brokers.NewPermission(db))
+	rs := services.NewRole(brokers.NewRole(db))
+	rts := services.NewRating(brokers.NewRating(db))
+	rvs := services.NewReview(brokers.NewReview(db))
+	ls := services.NewList(brokers.NewList(db))
+	pps := services.NewPerson(brokers.NewPerson(db))
+	cs := services.NewCredit(brokers.NewCredit(db))
+	gs := services.NewGenre(gb)
+	is := services.NewImage(brokers.NewImage(db), store)
+	cls := services.NewCollection(brokers.NewCollection(db))
+
+	original := conf.Titles.OriginalLanguage
+	if original == "" {
+		original = defaultOriginalLanguage
+	}
+	originalTag, err := language.Parse(original)
+	if err != nil {
+		return nil, fmt.Errorf("titles.originalLanguage: %w", err)
+	}
+	tts := services.NewTitle(brokers.NewTitle(db), originalTag)
+
+	var cache services.Cache
+	if conf.Cache.Enabled {
+		size := conf.Cache.Size
+		if size <= 0 {
+			size = defaultCacheSize
+		}
+		ttl, err := parseDuration("cache.ttl", conf.Cache.TTL, defaultCacheTTL)
+		if err != nil {
+			return nil, err
+		}
+		cache = services.NewLRUCache(size, ttl)
+		us = services.NewCachedUser(us, cache)
+		ts = services.NewCachedToken(ts, cache)
+		ps = services.NewCachedPermission(ps, cache)
+		rs = services.NewCachedRole(rs, cache)
+	}
+
 	return &Application{
-		Config: &conf,
-		Logger: log,
+		Config:  &conf,
+		Logger:  log,
+		Cache:   cache,
+		Exports: make(chan struct{}, conf.Export.MaxConcurrent),
 		Services: Services{
 			Movie:      ms,
 			User:       us,
 			Token:      ts,
 			Permission: ps,
+			Role:       rs,
+			Rating:     rts,
+			Review:     rvs,
+			List:       ls,
+			Person:     pps,
+			Credit:     cs,
+			Genre:      gs,
+			Image:      is,
+			Collection: cls,
+			Title:      tts,
 		},
 		SMTP: mailer.New(conf.SMTP.Host, conf.SMTP.Port, conf.SMTP.Username, conf.SMTP.Password, conf.SMTP.Sender),
-	}
+	}, nil
 }
 
 func (app *Application) LogError(r *http.Request, err error) {
@@ -0,0 +1,37 @@
+package app
+
+import "testing"
+
+func TestRateCost(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		burst   int
+		cost    int
+		want    int
+		wantErr bool
+	}{
+		{name: "default", enabled: true, burst: 4, want: 2},
+		{name: "configured", enabled: true, burst: 4, cost: 3, want: 3},
+		{name: "default above burst", enabled: true, burst: 1, want: 1},
+		{name: "configured above burst", enabled: true, burst: 4, cost: 5, wantErr: true},
+		{name: "limiter disabled", burst: 1, cost: 5, want: 5},
+		{name: "negative", enabled: true, burst: 4, cost: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var conf Config
+			conf.Limiter.Enabled = tt.enabled
+			conf.Limiter.Burst = tt.burst
+
+			got, err := rateCost(conf, "suggest.rateCost", tt.cost, 2)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v; want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("cost = %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
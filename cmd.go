@@ -2,21 +2,31 @@ package greenlight
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"expvar"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/rwx-yxu/greenlight/app"
 	"github.com/rwx-yxu/greenlight/database"
+	"github.com/rwx-yxu/greenlight/internal/imdb"
 	"github.com/rwx-yxu/greenlight/internal/jsonlog"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/services"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+	"github.com/rwx-yxu/greenlight/migrations"
 	"github.com/rwx-yxu/greenlight/routes"
 	Z "github.com/rwxrob/bonzai/z"
 	"github.com/rwxrob/conf"
@@ -28,6 +38,23 @@ func init() {
 	Z.Conf.SoftInit()
 }
 
+// loadConfig unmarshals the yaml configuration stored against the root greenlight
+// command. Using Root() rather than Caller means nested commands such as
+// `greenlight migrate up` read the same configuration as `greenlight start`.
+func loadConfig(x *Z.Cmd) (app.Config, error) {
+	var config app.Config
+	c, err := x.Root().C("")
+	if err != nil {
+		return config, errors.New("Config has not been initialised")
+	}
+	err = yaml.Unmarshal([]byte(c), &config)
+	if err != nil {
+		return config, err
+	}
+	config.CORS.TrustedOrigins = strings.Fields(config.CORS.Origins)
+	return config, nil
+}
+
 var Cmd = &Z.Cmd{
 	Name:      `greenlight`,
 	Version:   `v0.0.1`,
@@ -38,7 +65,7 @@ var Cmd = &Z.Cmd{
 	Issues:    `github.com/rwx-yxu/greenlight/issues`,
 
 	Commands: []*Z.Cmd{
-		StartCmd,
+		StartCmd, MigrateCmd, ImportCmd,
 
 		// standard external branch imports (see rwxrob/{help,conf,vars})
 		help.Cmd, conf.Cmd,
@@ -54,16 +81,10 @@ var StartCmd = &Z.Cmd{
 	Summary:     help.S(_start),
 	Description: help.D(_start),
 	Call: func(x *Z.Cmd, _ ...string) error {
-		var config app.Config
-		c, err := x.Caller.C("")
-		if err != nil {
-			return errors.New("Config has not been initialised")
-		}
-		err = yaml.Unmarshal([]byte(c), &config)
+		config, err := loadConfig(x)
 		if err != nil {
 			return err
 		}
-		config.CORS.TrustedOrigins = strings.Fields(config.CORS.Origins)
 		logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 		db, err := database.OpenPostgres(config)
 		if err != nil {
@@ -71,6 +92,19 @@ var StartCmd = &Z.Cmd{
 		}
 		logger.PrintInfo("database connection pool established", nil)
 		defer db.Close()
+		if config.DB.AutoMigrate {
+			m, err := database.NewMigrator(db, migrations.FS)
+			if err != nil {
+				return err
+			}
+			applied, err := m.Up()
+			if err != nil {
+				return err
+			}
+			logger.PrintInfo("database migrations applied", map[string]string{
+				"count": strconv.Itoa(len(applied)),
+			})
+		}
 		config.Server.Version = x.Caller.GetVersion()
 		expvar.NewString("version").Set(config.Server.Version)
 		// Publish the number of active goroutines.
@@ -87,7 +121,17 @@ var StartCmd = &Z.Cmd{
 		expvar.Publish("timestamp", expvar.Func(func() any {
 			return time.Now().Unix()
 		}))
-		app := app.NewApp(config, db, logger)
+		app, err := app.NewApp(config, db, logger)
+		if err != nil {
+			return err
+		}
+
+		// Publish the hit and miss counts of the user and permissions cache.
+		if app.Cache != nil {
+			expvar.Publish("cache", expvar.Func(func() any {
+				return app.Cache.Stats()
+			}))
+		}
 
 		srv := &http.Server{
 			Addr:         fmt.Sprintf(":%d", config.Server.Port),
@@ -150,3 +194,405 @@ var StartCmd = &Z.Cmd{
 
 	},
 }
+
+// openMigrator opens the database configured for the root command and loads the
+// embedded migrations. The caller is responsible for closing the returned *sql.DB.
+func openMigrator(x *Z.Cmd) (*database.Migrator, *sql.DB, error) {
+	config, err := loadConfig(x)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := database.OpenPostgres(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := database.NewMigrator(db, migrations.FS)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return m, db, nil
+}
+
+func printMigrations(verb string, done []database.Migration) {
+	if len(done) == 0 {
+		fmt.Println("no change")
+		return
+	}
+	for _, m := range done {
+		fmt.Printf("%s %06d_%s\n", verb, m.Version, m.Name)
+	}
+}
+
+var MigrateCmd = &Z.Cmd{
+	Name:        `migrate`,
+	Aliases:     []string{`m`},
+	Commands:    []*Z.Cmd{MigrateStatusCmd, MigrateUpCmd, MigrateDownCmd, MigrateGotoCmd, MigrateForceCmd, help.Cmd},
+	Summary:     help.S(_migrate),
+	Description: help.D(_migrate),
+}
+
+var MigrateStatusCmd = &Z.Cmd{
+	Name:     `status`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Summary:  `print every migration and whether it has been applied`,
+	NoArgs:   true,
+	Call: func(x *Z.Cmd, _ ...string) error {
+		m, db, err := openMigrator(x)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%06d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	},
+}
+
+var MigrateUpCmd = &Z.Cmd{
+	Name:     `up`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Summary:  `apply every pending migration`,
+	NoArgs:   true,
+	Call: func(x *Z.Cmd, _ ...string) error {
+		m, db, err := openMigrator(x)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		done, err := m.Up()
+		printMigrations("applied", done)
+		return err
+	},
+}
+
+var MigrateDownCmd = &Z.Cmd{
+	Name:     `down`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Summary:  `roll back the last N applied migrations (default 1)`,
+	Usage:    `[N]`,
+	MaxArgs:  1,
+	Call: func(x *Z.Cmd, args ...string) error {
+		n := 1
+		if len(args) == 1 {
+			var err error
+			n, err = strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid number of migrations: %q", args[0])
+			}
+		}
+		m, db, err := openMigrator(x)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		done, err := m.Down(n)
+		printMigrations("rolled back", done)
+		return err
+	},
+}
+
+var MigrateGotoCmd = &Z.Cmd{
+	Name:     `goto`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Summary:  `migrate up or down to version V`,
+	Usage:    `V`,
+	NumArgs:  1,
+	Call: func(x *Z.Cmd, args ...string) error {
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid migration version: %q", args[0])
+		}
+		m, db, err := openMigrator(x)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		done, err := m.Goto(version)
+		printMigrations("migrated", done)
+		return err
+	},
+}
+
+var MigrateForceCmd = &Z.Cmd{
+	Name:     `force`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Summary:  `record version V as current without running any SQL`,
+	Usage:    `V`,
+	NumArgs:  1,
+	Call: func(x *Z.Cmd, args ...string) error {
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid migration version: %q", args[0])
+		}
+		m, db, err := openMigrator(x)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if err := m.Force(version); err != nil {
+			return err
+		}
+		fmt.Printf("forced version %06d\n", version)
+		return nil
+	},
+}
+
+var ImportCmd = &Z.Cmd{
+	Name:        `import`,
+	Commands:    []*Z.Cmd{ImportIMDbCmd, help.Cmd},
+	Summary:     help.S(_import),
+	Description: help.D(_import),
+}
+
+const (
+	// imdbBatchSize is the number of movies created or updated in each transaction.
+	imdbBatchSize = 100
+
+	// imdbProgressInterval is how often progress is printed during an import.
+	imdbProgressInterval = 5 * time.Second
+)
+
+// imdbProgress counts what has happened to the titles of an IMDb dump so far. Reasons
+// counts each validation error that made a title invalid, and UnknownGenres each genre
+// name that isn't in the taxonomy.
+type imdbProgress struct {
+	Titles        int
+	Created       int
+	Updated       int
+	Unchanged     int
+	Invalid       int
+	Reasons       map[string]int
+	UnknownGenres map[string]int
+}
+
+func (p imdbProgress) print(line int) {
+	fmt.Printf("line %d: %d titles, %d created, %d updated, %d unchanged, %d invalid\n",
+		line, p.Titles, p.Created, p.Updated, p.Unchanged, p.Invalid)
+}
+
+// reject records why a title was invalid. A title with unknown genres is counted
+// against each of them rather than the combined error message.
+func (p *imdbProgress) reject(movie *models.Movie, v *validator.Validator, genres map[string]string) {
+	p.Invalid++
+	for key, message := range v.Errors {
+		if key == "genres" {
+			var unknown bool
+			for _, name := range movie.Genres {
+				if _, ok := genres[models.GenreSlug(name)]; !ok {
+					p.UnknownGenres[name]++
+					unknown = true
+				}
+			}
+			if unknown {
+				continue
+			}
+		}
+		p.Reasons[key+" "+message]++
+	}
+}
+
+// printCounts prints the counts of a reasons map, most common first.
+func printCounts(heading string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Println(heading)
+	for _, key := range keys {
+		fmt.Printf("  %8d  %s\n", counts[key], key)
+	}
+}
+
+// checkpointStamp identifies one copy of a dump by its size and modification time, so
+// that a checkpoint isn't applied to a newer dump downloaded to the same path.
+func checkpointStamp(info fs.FileInfo) string {
+	return fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano())
+}
+
+// readCheckpoint returns the last line committed by an earlier run of an import of the
+// dump described by info, or 0 if there wasn't one. A checkpoint written for another
+// copy of the dump is ignored with a warning.
+func readCheckpoint(path string, info fs.FileInfo) (int, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	line, stamp, _ := strings.Cut(strings.TrimSpace(string(b)), " ")
+	n, err := strconv.Atoi(line)
+	if err != nil {
+		return 0, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	if stamp != checkpointStamp(info) {
+		fmt.Printf("ignoring %s, which was written for a different copy of the dump\n", path)
+		return 0, nil
+	}
+	return n, nil
+}
+
+// writeCheckpoint records the last line committed by an import of the dump described
+// by info. The file is replaced by a rename so that it is never left half written.
+func writeCheckpoint(path string, info fs.FileInfo, line int) error {
+	tmp := path + ".tmp"
+	err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %s\n", line, checkpointStamp(info))), 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+var ImportIMDbCmd = &Z.Cmd{
+	Name:     `imdb`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Summary:  `create or update movies from a title.basics.tsv.gz dump`,
+	Usage:    `FILE [TYPE ...]`,
+	MinArgs:  1,
+	Call: func(x *Z.Cmd, args ...string) error {
+		types := args[1:]
+		if len(types) == 0 {
+			types = []string{"movie"}
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		r, err := imdb.NewBasicsReader(f, types...)
+		if err != nil {
+			return err
+		}
+
+		// The last line of each committed batch is kept next to the dump, so that an
+		// interrupted import carries on from there when it is run again on the same
+		// copy of the dump.
+		checkpoint := args[0] + ".checkpoint"
+		from, err := readCheckpoint(checkpoint, info)
+		if err != nil {
+			return err
+		}
+		if from > 0 {
+			fmt.Printf("resuming after line %d\n", from)
+			if err := r.SkipTo(from); err != nil {
+				return err
+			}
+		}
+
+		config, err := loadConfig(x)
+		if err != nil {
+			return err
+		}
+		db, err := database.OpenPostgres(config)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		app, err := app.NewApp(config, db, jsonlog.New(os.Stderr, jsonlog.LevelError))
+		if err != nil {
+			return err
+		}
+
+		// Every row's genres are resolved against the same copy of the taxonomy, as in
+		// the import endpoint.
+		genres, err := app.Genre.FindLookup()
+		if err != nil {
+			return err
+		}
+
+		progress := imdbProgress{Reasons: map[string]int{}, UnknownGenres: map[string]int{}}
+		var batch []*models.Movie
+
+		// flush creates the movies in the batch whose IMDb id is new and updates the
+		// ones whose isn't, with no user recorded against the revisions. Once the
+		// batch is committed its last line becomes the checkpoint.
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			created, updated, err := app.Movie.UpsertBatch(0, models.SourceIMDb, batch)
+			if err != nil {
+				return err
+			}
+			progress.Created += created
+			progress.Updated += updated
+			progress.Unchanged += len(batch) - created - updated
+			batch = nil
+			return writeCheckpoint(checkpoint, info, r.Line)
+		}
+
+		last := time.Now()
+		for {
+			movie, err := r.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				progress.print(r.Line)
+				return err
+			}
+			progress.Titles++
+
+			v := app.Movie.Validate(*movie)
+			if v.Valid() {
+				movie.Genres = services.ResolveGenres(&v, "genres", movie.Genres, genres)
+			}
+			if !v.Valid() {
+				progress.reject(movie, &v, genres)
+				continue
+			}
+
+			batch = append(batch, movie)
+			if len(batch) == imdbBatchSize {
+				if err := flush(); err != nil {
+					progress.print(r.Line)
+					return err
+				}
+			}
+			if time.Since(last) >= imdbProgressInterval {
+				progress.print(r.Line)
+				last = time.Now()
+			}
+		}
+
+		if err := flush(); err != nil {
+			progress.print(r.Line)
+			return err
+		}
+		progress.print(r.Line)
+		printCounts("invalid titles:", progress.Reasons)
+		printCounts("unknown genres:", progress.UnknownGenres)
+
+		// The whole dump has been read, so a later run starts from the top again to
+		// pick up the changes in a newer dump.
+		err = os.Remove(checkpoint)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	},
+}
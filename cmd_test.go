@@ -0,0 +1,47 @@
+package greenlight
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "title.basics.tsv")
+	checkpoint := dump + ".checkpoint"
+	if err := os.WriteFile(dump, []byte("first dump"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line, err := readCheckpoint(checkpoint, info); err != nil || line != 0 {
+		t.Fatalf("readCheckpoint with no checkpoint = %d, %v; want 0, nil", line, err)
+	}
+	if err := writeCheckpoint(checkpoint, info, 1200); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := readCheckpoint(checkpoint, info); err != nil || line != 1200 {
+		t.Fatalf("readCheckpoint = %d, %v; want 1200, nil", line, err)
+	}
+
+	// A newer dump downloaded to the same path doesn't resume from the old checkpoint.
+	if err := os.WriteFile(dump, []byte("second, longer dump"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := info.ModTime().Add(time.Hour)
+	if err := os.Chtimes(dump, later, later); err != nil {
+		t.Fatal(err)
+	}
+	newer, err := os.Stat(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line, err := readCheckpoint(checkpoint, newer); err != nil || line != 0 {
+		t.Errorf("readCheckpoint for a newer dump = %d, %v; want 0, nil", line, err)
+	}
+}
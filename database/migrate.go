@@ -0,0 +1,336 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The advisory lock key used to serialise migrations. Any constant works as long as
+// every replica uses the same one, so that two processes starting at the same time
+// cannot both try to apply the same migration.
+const migrationLockID int64 = 4_832_190_417
+
+var (
+	ErrUnknownMigration = errors.New("unknown migration version")
+	ErrNoMigrations     = errors.New("no migrations found")
+)
+
+// Migration files are named <version>_<name>.<direction>.sql, for example
+// 000001_create_movies_table.up.sql.
+var migrationFileRX = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator reads every migration file from the root of fsys and returns a
+// Migrator which applies them to db in version order.
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		matches := migrationFileRX.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, matches[2])
+		}
+
+		switch matches[3] {
+		case "up":
+			m.Up = string(body)
+		case "down":
+			m.Down = string(body)
+		}
+	}
+
+	if len(byVersion) == 0 {
+		return nil, ErrNoMigrations
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies every pending migration and returns the ones that were applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	return m.Goto(m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down rolls back the n most recently applied migrations and returns the ones that
+// were rolled back.
+func (m *Migrator) Down(n int) ([]Migration, error) {
+	if n < 1 {
+		return nil, errors.New("number of migrations to roll back must be greater than zero")
+	}
+
+	var done []Migration
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < n; i-- {
+			if _, ok := applied[m.migrations[i].Version]; !ok {
+				continue
+			}
+			if err := m.run(ctx, conn, m.migrations[i], false); err != nil {
+				return err
+			}
+			done = append(done, m.migrations[i])
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Goto migrates the database to the given version, rolling back every applied
+// migration above it and applying every pending migration up to and including it.
+// A version of 0 rolls back everything.
+func (m *Migrator) Goto(version int64) ([]Migration, error) {
+	if version != 0 && m.find(version) == nil {
+		return nil, ErrUnknownMigration
+	}
+
+	var done []Migration
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		// Roll back from the newest migration downwards first so that the down files
+		// run in the reverse of the order that their up files were applied in.
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok || mig.Version <= version {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok || mig.Version > version {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Force records the database as being at the given version without running any SQL.
+// This is used to recover from a migration that failed part way through, or to adopt
+// a database that was migrated by an external tool.
+func (m *Migrator) Force(version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return ErrUnknownMigration
+	}
+
+	return m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_versions WHERE version > $1`, version)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if mig.Version > version {
+				break
+			}
+			_, err = tx.ExecContext(ctx, `
+                INSERT INTO schema_versions (version, name)
+                VALUES ($1, $2)
+                ON CONFLICT (version) DO NOTHING`, mig.Version, mig.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+}
+
+// Status returns every known migration along with whether it has been applied.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var status []MigrationStatus
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			appliedAt, ok := applied[mig.Version]
+			status = append(status, MigrationStatus{
+				Migration: mig,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+		return nil
+	})
+
+	return status, err
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// withLock takes a session level advisory lock on a dedicated connection, makes sure
+// the schema_versions table exists and then calls fn with that connection. Session
+// level locks belong to the connection that took them, which is why everything has
+// to run on the same *sql.Conn rather than on the pool.
+func (m *Migrator) withLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Wait for up to a minute for any other replica to finish migrating.
+	lockCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	_, err = conn.ExecContext(lockCtx, `SELECT pg_advisory_lock($1)`, migrationLockID)
+	if err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_versions (
+            version bigint PRIMARY KEY,
+            name text NOT NULL,
+            applied_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+        )`)
+	if err != nil {
+		return err
+	}
+
+	return fn(ctx, conn)
+}
+
+// applied returns the applied_at time of every applied migration keyed by version.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_versions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// run executes the up or down SQL of a single migration and records the result in
+// schema_versions inside the same transaction, so that a failing migration leaves
+// neither its changes nor its version behind.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		_, err = tx.ExecContext(ctx, mig.Up)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `INSERT INTO schema_versions (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+		}
+	} else {
+		_, err = tx.ExecContext(ctx, mig.Down)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `DELETE FROM schema_versions WHERE version = $1`, mig.Version)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("migration %06d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	return tx.Commit()
+}
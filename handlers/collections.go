@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/app"
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/filter"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// collectionWriteError sends the response for an error returned when changing a
+// collection or the movies in it.
+func collectionWriteError(c *gin.Context, app app.Application, err error) {
+	v := validator.New()
+	switch {
+	case errors.Is(err, brokers.ErrDuplicateCollectionName):
+		v.AddError("name", "a collection with this name already exists")
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+	case errors.Is(err, brokers.ErrMovieInCollection):
+		v.AddError("movie_id", "the movie already belongs to a collection")
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+	case errors.Is(err, brokers.ErrInvalidCollectionOrder):
+		v.AddError("movie_ids", "must contain every movie in the collection and nothing else")
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+	case errors.Is(err, brokers.ErrRecordNotFound):
+		ErrorResponse(c, app, NotFoundError(err))
+	case errors.Is(err, brokers.ErrEditConflict):
+		ErrorResponse(c, app, EditConflictError(err))
+	default:
+		ErrorResponse(c, app, InternalServerError(err))
+	}
+}
+
+func ListCollectionsHandler(c *gin.Context, app app.Application) {
+	var input filter.Filter
+
+	v := validator.New()
+	input.Page = ReadInt(c, "page", 1, v)
+	input.PageSize = ReadInt(c, "page_size", 20, v)
+	input.Sort = ReadString(c, "sort", "name")
+	input.SortSafeList = []string{"id", "name", "-id", "-name"}
+	if input.Validate(v); !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	collections, metadata, err := app.Collection.FindAll(input)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"collections": collections, "metadata": metadata})
+}
+
+func CreateCollectionHandler(c *gin.Context, app app.Application) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Ordering    string `json:"ordering"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	col := &models.Collection{
+		Name:        input.Name,
+		Description: input.Description,
+		Ordering:    input.Ordering,
+	}
+	if col.Ordering == "" {
+		col.Ordering = models.CollectionRelease
+	}
+
+	v, err := app.Collection.Add(col)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		collectionWriteError(c, app, err)
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/v1/collections/%d", col.ID))
+	c.JSON(http.StatusCreated, gin.H{"collection": col})
+}
+
+func ShowCollectionHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	col, err := app.Collection.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"collection": col})
+}
+
+func UpdateCollectionHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	col, err := app.Collection.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Ordering    *string `json:"ordering"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	if input.Name != nil {
+		col.Name = *input.Name
+	}
+	if input.Description != nil {
+		col.Description = *input.Description
+	}
+	if input.Ordering != nil {
+		col.Ordering = *input.Ordering
+	}
+
+	v, err := app.Collection.Edit(col)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		collectionWriteError(c, app, err)
+		return
+	}
+
+	// A change of ordering changes the order of the movies, so read them again.
+	col, err = app.Collection.FindByID(col.ID)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"collection": col})
+}
+
+// DeleteCollectionHandler deletes a collection, leaving its movies in place.
+func DeleteCollectionHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	err = app.Collection.RemoveByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "collection successfully deleted"})
+}
+
+func AddCollectionMovieHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	var input struct {
+		MovieID int64 `json:"movie_id"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	err = app.Collection.AddMovie(id, input.MovieID)
+	if err != nil {
+		collectionWriteError(c, app, err)
+		return
+	}
+
+	col, err := app.Collection.FindByID(id)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"collection": col})
+}
+
+func DeleteCollectionMovieHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+	movieID, err := ReadNamedIDParam(c, "movie_id")
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	err = app.Collection.RemoveMovie(id, movieID)
+	if err != nil {
+		collectionWriteError(c, app, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "movie successfully removed from collection"})
+}
+
+// ReorderCollectionMoviesHandler sets the custom order of a collection, given as the
+// ids of every movie in it. A collection ordered by release only uses the custom order
+// for movies released in the same year.
+func ReorderCollectionMoviesHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	var input struct {
+		MovieIDs []int64 `json:"movie_ids"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	v, err := app.Collection.ReorderMovies(id, input.MovieIDs)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		collectionWriteError(c, app, err)
+		return
+	}
+
+	col, err := app.Collection.FindByID(id)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"collection": col})
+}
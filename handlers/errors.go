@@ -28,27 +28,33 @@ type HandleError struct {
 }
 
 var HttpErrorMessages = map[int]string{
-	http.StatusNotFound:            "the requested resource could not be found",
-	http.StatusBadRequest:          "the requested action cannot be performed with the provided parameters",
-	http.StatusInternalServerError: "Internal server error",
-	http.StatusMethodNotAllowed:    "the %s method is not supported for this resource",
-	http.StatusUnprocessableEntity: "the content has failed validation",
-	http.StatusConflict:            "the requested operation could not be completed due to a conflict with the current state of the server",
-	http.StatusTooManyRequests:     "the requested operation could not be completed due to too many requests",
-	http.StatusUnauthorized:        "invalid authentication credentials",
-	http.StatusForbidden:           "you do not have permission to access this resource",
+	http.StatusNotFound:              "the requested resource could not be found",
+	http.StatusBadRequest:            "the requested action cannot be performed with the provided parameters",
+	http.StatusInternalServerError:   "Internal server error",
+	http.StatusMethodNotAllowed:      "the %s method is not supported for this resource",
+	http.StatusUnprocessableEntity:   "the content has failed validation",
+	http.StatusConflict:              "the requested operation could not be completed due to a conflict with the current state of the server",
+	http.StatusTooManyRequests:       "the requested operation could not be completed due to too many requests",
+	http.StatusUnauthorized:          "invalid authentication credentials",
+	http.StatusForbidden:             "you do not have permission to access this resource",
+	http.StatusPreconditionFailed:    "the resource has changed since the version given in the If-Match header",
+	http.StatusUnsupportedMediaType:  "the %s content type is not supported for this resource",
+	http.StatusRequestEntityTooLarge: "the request body must not be larger than %d bytes",
 }
 
 var HttpErrorCodeStrings = map[int]string{
-	http.StatusNotFound:            "NOT_FOUND",
-	http.StatusBadRequest:          "BAD_REQUEST",
-	http.StatusMethodNotAllowed:    "METHOD_NOT_ALLOWED",
-	http.StatusUnprocessableEntity: "UNPROCESSABLE_CONTENT",
-	http.StatusInternalServerError: "INTERNAL_SERVER_ERROR",
-	http.StatusConflict:            "STATUS_CONFLICT",
-	http.StatusTooManyRequests:     "TOO_MANY_REQUESTS",
-	http.StatusUnauthorized:        "INVALID_CREDENTIALS",
-	http.StatusForbidden:           "STATUS_FORBIDDEN",
+	http.StatusNotFound:              "NOT_FOUND",
+	http.StatusBadRequest:            "BAD_REQUEST",
+	http.StatusMethodNotAllowed:      "METHOD_NOT_ALLOWED",
+	http.StatusUnprocessableEntity:   "UNPROCESSABLE_CONTENT",
+	http.StatusInternalServerError:   "INTERNAL_SERVER_ERROR",
+	http.StatusConflict:              "STATUS_CONFLICT",
+	http.StatusTooManyRequests:       "TOO_MANY_REQUESTS",
+	http.StatusUnauthorized:          "INVALID_CREDENTIALS",
+	http.StatusForbidden:             "STATUS_FORBIDDEN",
+	http.StatusPreconditionFailed:    "PRECONDITION_FAILED",
+	http.StatusUnsupportedMediaType:  "UNSUPPORTED_MEDIA_TYPE",
+	http.StatusRequestEntityTooLarge: "CONTENT_TOO_LARGE",
 }
 
 func (h HandleError) Error() string {
@@ -249,6 +255,45 @@ func NotPermitted() error {
 	})
 }
 
+func PreconditionFailedError() error {
+	response := ErrorResponseBody{
+		Code:    HttpErrorCodeStrings[http.StatusPreconditionFailed],
+		Message: HttpErrorMessages[http.StatusPreconditionFailed],
+		Details: []ErrorDetail{},
+	}
+
+	return fmt.Errorf("%w", HandleError{
+		StatusCode: http.StatusPreconditionFailed,
+		Response:   response,
+	})
+}
+
+func UnsupportedMediaTypeError(contentType string) error {
+	response := ErrorResponseBody{
+		Code:    HttpErrorCodeStrings[http.StatusUnsupportedMediaType],
+		Message: fmt.Sprintf(HttpErrorMessages[http.StatusUnsupportedMediaType], contentType),
+		Details: []ErrorDetail{},
+	}
+
+	return fmt.Errorf("%w", HandleError{
+		StatusCode: http.StatusUnsupportedMediaType,
+		Response:   response,
+	})
+}
+
+func ContentTooLargeError(limit int64) error {
+	response := ErrorResponseBody{
+		Code:    HttpErrorCodeStrings[http.StatusRequestEntityTooLarge],
+		Message: fmt.Sprintf(HttpErrorMessages[http.StatusRequestEntityTooLarge], limit),
+		Details: []ErrorDetail{},
+	}
+
+	return fmt.Errorf("%w", HandleError{
+		StatusCode: http.StatusRequestEntityTooLarge,
+		Response:   response,
+	})
+}
+
 func RateLimitExceededError() error {
 	response := ErrorResponseBody{
 		Code:    HttpErrorCodeStrings[http.StatusTooManyRequests],
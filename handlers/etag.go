@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+// MovieETag returns a strong entity tag for a movie. The version is bumped on every
+// update, so the id and version together identify one exact state of the movie's own
+// fields. This is the tag If-Match is compared against, so a rating, which changes
+// the average and vote count without an update, doesn't fail an editor's write.
+func MovieETag(movie *models.Movie) string {
+	return fmt.Sprintf(`"%d-%d"`, movie.ID, movie.Version)
+}
+
+// MovieListETag returns a weak entity tag for a page of movies, derived from the tag
+// of every movie on it and the title it is listed under, which may be localised. It is
+// weak because the same movies could be encoded differently, for example with
+// different pagination metadata.
+func MovieListETag(movies []*models.Movie) string {
+	h := sha256.New()
+	for _, movie := range movies {
+		fmt.Fprintf(h, "%d-%d-%d-%g-%s-%q,", movie.ID, movie.Version, movie.Votes, movie.Rating, movie.TitleLanguage, movie.Title)
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// MovieDetailETag returns the entity tag for a movie as it is shown, with its rating
+// and vote count and any credits, collection, alternate titles or localised title, all
+// of which can change without the movie's version changing. The tag is the movie's own tag with a hash of
+// the rest appended after a semicolon, so that a client can send it back in If-Match
+// and MoviePreconditionHolds still compares it against the movie alone.
+func MovieDetailETag(movie *models.Movie) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s-%d-%g", MovieETag(movie), movie.Votes, movie.Rating)
+	for _, c := range movie.Credits {
+		fmt.Fprintf(h, ",%d-%d-%s-%q-%d-%q", c.ID, c.PersonID, c.Role, c.Character, c.Billing, c.PersonName)
+	}
+	fmt.Fprintf(h, ";%s-%q", movie.TitleLanguage, movie.Title)
+	for _, t := range movie.Titles {
+		fmt.Fprintf(h, ",%s-%q", t.Language, t.Title)
+	}
+	if mc := movie.Collection; mc != nil {
+		fmt.Fprintf(h, ";%d-%q-%d-%d", mc.ID, mc.Name, mc.Position, mc.Total)
+		for _, e := range []*models.CollectionEntry{mc.Previous, mc.Next} {
+			if e != nil {
+				fmt.Fprintf(h, ",%d-%q-%d", e.MovieID, e.Title, e.Year)
+			}
+		}
+	}
+	return strings.TrimSuffix(MovieETag(movie), `"`) + ";" + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// ETagMatches reports whether etag is one of the comma separated entity tags in an
+// If-Match or If-None-Match header, or the header is "*". If-Match uses the strong
+// comparison, where weak tags never match, and If-None-Match the weak comparison,
+// where the W/ prefix is ignored.
+func ETagMatches(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// NotModified sets the ETag header and reports whether the request's If-None-Match
+// header already matches it, in which case it has also sent a 304 Not Modified
+// response and the caller must not write a body.
+func NotModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	header := c.GetHeader("If-None-Match")
+	if header == "" || !ETagMatches(header, etag, true) {
+		return false
+	}
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// PreconditionHolds reports whether the request's If-Match header, if it has one,
+// matches the current entity tag of the resource.
+func PreconditionHolds(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-Match")
+	return header == "" || ETagMatches(header, etag, false)
+}
+
+// MoviePreconditionHolds is PreconditionHolds for a movie. A detail tag from
+// MovieDetailETag matches when the movie tag before its semicolon does, so that a
+// client which fetched the movie with its credits or a localised title can still make
+// a conditional write. Weak tags never match, as for any If-Match header.
+func MoviePreconditionHolds(c *gin.Context, movie *models.Movie) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return true
+	}
+	candidates := strings.Split(header, ",")
+	for i, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+		if base, _, ok := strings.Cut(candidate, ";"); ok && strings.HasPrefix(base, `"`) {
+			candidate = base + `"`
+		}
+		candidates[i] = candidate
+	}
+	return ETagMatches(strings.Join(candidates, ","), MovieETag(movie), false)
+}
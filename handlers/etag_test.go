@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		etag   string
+		weak   bool
+		want   bool
+	}{
+		{"exact", `"1-2"`, `"1-2"`, false, true},
+		{"different", `"1-1"`, `"1-2"`, false, false},
+		{"any in list", `"a", "1-2" ,"b"`, `"1-2"`, false, true},
+		{"star", `*`, `"1-2"`, false, true},
+		{"weak header strong comparison", `W/"1-2"`, `"1-2"`, false, false},
+		{"weak etag strong comparison", `W/"abc"`, `W/"abc"`, false, false},
+		{"weak header weak comparison", `W/"1-2"`, `"1-2"`, true, true},
+		{"weak etag weak comparison", `"abc"`, `W/"abc"`, true, true},
+		{"unquoted", `1-2`, `"1-2"`, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ETagMatches(tt.header, tt.etag, tt.weak)
+			if got != tt.want {
+				t.Errorf("ETagMatches(%q, %q, %t) = %t; want %t", tt.header, tt.etag, tt.weak, got, tt.want)
+			}
+		})
+	}
+}
+
+// newETagContext returns a gin context for a request with the given header set.
+func newETagContext(name, value string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/movies/1", nil)
+	if value != "" {
+		c.Request.Header.Set(name, value)
+	}
+	return c, w
+}
+
+func TestNotModified(t *testing.T) {
+	etag := MovieETag(&models.Movie{ID: 1, Version: 2})
+
+	c, w := newETagContext("If-None-Match", `W/"1-2"`)
+	if !NotModified(c, etag) {
+		t.Fatal("NotModified = false; want true for a weakly matching tag")
+	}
+	c.Writer.WriteHeaderNow()
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusNotModified)
+	}
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Errorf("ETag = %q; want %q", got, etag)
+	}
+
+	c, _ = newETagContext("If-None-Match", `"1-1"`)
+	if NotModified(c, etag) {
+		t.Error("NotModified = true; want false for an old version")
+	}
+}
+
+func TestPreconditionHolds(t *testing.T) {
+	etag := MovieETag(&models.Movie{ID: 1, Version: 2})
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", true},
+		{`"1-2"`, true},
+		{`"1-1"`, false},
+		{`W/"1-2"`, false},
+	}
+
+	for _, tt := range tests {
+		c, _ := newETagContext("If-Match", tt.header)
+		if got := PreconditionHolds(c, etag); got != tt.want {
+			t.Errorf("PreconditionHolds with If-Match %q = %t; want %t", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestMoviePreconditionHolds(t *testing.T) {
+	movie := &models.Movie{ID: 1, Version: 2}
+	shown := *movie
+	shown.Collection = &models.MovieCollection{
+		ID:       3,
+		Name:     "Trilogy",
+		Position: 1,
+		Total:    3,
+		Next:     &models.CollectionEntry{Position: 2, MovieID: 4, Title: "Sequel", Year: 2001},
+	}
+	detail := MovieDetailETag(&shown)
+
+	edited := *movie
+	edited.Version++
+
+	tests := []struct {
+		name   string
+		movie  *models.Movie
+		header string
+		want   bool
+	}{
+		{"no header", movie, "", true},
+		{"movie tag", movie, MovieETag(movie), true},
+		{"collection detail tag", movie, detail, true},
+		{"detail tag in list", movie, `"other", ` + detail, true},
+		{"detail tag after edit", &edited, detail, false},
+		{"weak detail tag", movie, "W/" + detail, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newETagContext("If-Match", tt.header)
+			if got := MoviePreconditionHolds(c, tt.movie); got != tt.want {
+				t.Errorf("MoviePreconditionHolds with If-Match %q = %t; want %t", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+// A rating changes what is shown but not the movie itself, so it changes the detail
+// tag without failing a conditional write.
+func TestMovieDetailETagRating(t *testing.T) {
+	movie := &models.Movie{ID: 1, Version: 2, Votes: 10, Rating: 7.5}
+	before := MovieDetailETag(movie)
+
+	rated := *movie
+	rated.Votes, rated.Rating = 11, 7.6
+	if after := MovieDetailETag(&rated); after == before {
+		t.Errorf("detail tag %q didn't change with the rating", after)
+	}
+	if MovieETag(&rated) != MovieETag(movie) {
+		t.Errorf("movie tag changed with the rating: %q, was %q", MovieETag(&rated), MovieETag(movie))
+	}
+
+	c, _ := newETagContext("If-Match", before)
+	if !MoviePreconditionHolds(c, &rated) {
+		t.Errorf("MoviePreconditionHolds with If-Match %q after a rating = false; want true", before)
+	}
+}
+
+// A movie localised for different languages has a different tag for each, so a cache
+// keeps them apart, but any of them can be sent back in If-Match.
+func TestMovieDetailETagLocalised(t *testing.T) {
+	movie := &models.Movie{ID: 1, Title: "Le Fabuleux Destin d'Amélie Poulain", Version: 2}
+	french := *movie
+	english := *movie
+	english.Title, english.OriginalTitle, english.TitleLanguage = "Amélie", movie.Title, "en"
+
+	frenchTag, englishTag := MovieDetailETag(&french), MovieDetailETag(&english)
+	if frenchTag == englishTag {
+		t.Fatalf("localised tags are both %q; want them to differ", frenchTag)
+	}
+
+	for _, tag := range []string{frenchTag, englishTag} {
+		c, _ := newETagContext("If-Match", tag)
+		if !MoviePreconditionHolds(c, movie) {
+			t.Errorf("MoviePreconditionHolds with If-Match %q = false; want true", tag)
+		}
+	}
+
+	c, _ := newETagContext("If-None-Match", frenchTag)
+	if NotModified(c, englishTag) {
+		t.Error("NotModified = true for the tag of another language; want false")
+	}
+}
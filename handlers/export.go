@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/app"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// A movieExporter writes movies to the response in one export format.
+type movieExporter interface {
+	Begin() error
+	Write(movie *models.Movie) error
+	End() error
+}
+
+// ExportMoviesHandler streams every movie matching the same filters as the movie list
+// as a csv, ndjson or json download. The response is written as the rows are read, so
+// it is never held in memory all at once.
+//
+// Once the first row has been sent the status code can't be changed, so an error part
+// way through is only logged and the response is cut short. Only export.maxConcurrent
+// exports run at once, and any more are refused with a 429.
+func ExportMoviesHandler(c *gin.Context, app app.Application) {
+	v := validator.New()
+	input := ReadMovieFilter(c, v)
+	format := ReadString(c, "format", "csv")
+	v.Check(validator.PermittedValue(format, "csv", "ndjson", "json"), "format", "must be csv, ndjson or json")
+
+	// The export isn't paginated, so give the page parameters values which pass
+	// validation.
+	input.Page, input.PageSize = 1, 1
+	if input.Validate(v); !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	select {
+	case app.Exports <- struct{}{}:
+		defer func() { <-app.Exports }()
+	default:
+		ErrorResponse(c, app, RateLimitExceededError())
+		return
+	}
+
+	timeout := app.Config.Export.TimeoutDuration
+	// Push the write deadline set by the server's WriteTimeout back, and stop reading
+	// from the database at the same time.
+	err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(timeout))
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	var exporter movieExporter
+	var contentType string
+	switch format {
+	case "csv":
+		exporter, contentType = &csvExporter{w: csv.NewWriter(c.Writer)}, "text/csv; charset=utf-8"
+	case "ndjson":
+		exporter, contentType = &ndjsonExporter{enc: json.NewEncoder(c.Writer)}, "application/x-ndjson"
+	case "json":
+		exporter, contentType = &jsonExporter{w: c.Writer}, "application/json"
+	}
+
+	filename := fmt.Sprintf("movies-%s.%s", time.Now().UTC().Format("20060102"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	err = exporter.Begin()
+	if err == nil {
+		err = app.Movie.Export(ctx, input, exporter.Write)
+	}
+	if err == nil {
+		err = exporter.End()
+	}
+	if err != nil {
+		app.LogError(c.Request, err)
+	}
+}
+
+// csvExporter writes one movie per record. The title, year, runtime and genres columns
+// are in the form the CSV import reads.
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) Begin() error {
+	return e.w.Write([]string{"id", "title", "year", "runtime", "genres", "version", "rating", "votes"})
+}
+
+func (e *csvExporter) Write(movie *models.Movie) error {
+	return e.w.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		strconv.FormatInt(int64(movie.Year), 10),
+		strconv.FormatInt(int64(movie.Runtime), 10),
+		strings.Join(movie.Genres, ","),
+		strconv.FormatInt(int64(movie.Version), 10),
+		strconv.FormatFloat(float64(movie.Rating), 'g', -1, 32),
+		strconv.FormatInt(int64(movie.Votes), 10),
+	})
+}
+
+func (e *csvExporter) End() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonExporter writes one movie per line, in the same form as the rest of the API.
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExporter) Begin() error { return nil }
+
+func (e *ndjsonExporter) Write(movie *models.Movie) error {
+	return e.enc.Encode(movie)
+}
+
+func (e *ndjsonExporter) End() error { return nil }
+
+// jsonExporter writes a single {"movies": [...]} object, like the list endpoint
+// without the metadata.
+type jsonExporter struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonExporter) Begin() error {
+	_, err := io.WriteString(e.w, `{"movies":[`)
+	return err
+}
+
+func (e *jsonExporter) Write(movie *models.Movie) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		js = append([]byte(","), js...)
+	}
+	e.count++
+	_, err = e.w.Write(js)
+	return err
+}
+
+func (e *jsonExporter) End() error {
+	_, err := io.WriteString(e.w, "]}\n")
+	return err
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/app"
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/services"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// ListGenresHandler returns the whole genre taxonomy with the number of movies filed
+// under each genre.
+func ListGenresHandler(c *gin.Context, app app.Application) {
+	genres, err := app.Genre.FindAll()
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"genres": genres})
+}
+
+func CreateGenreHandler(c *gin.Context, app app.Application) {
+	var input struct {
+		Name    string   `json:"name"`
+		Slug    string   `json:"slug"`
+		Aliases []string `json:"aliases"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	genre := &models.Genre{
+		Name:    input.Name,
+		Slug:    input.Slug,
+		Aliases: input.Aliases,
+	}
+	if genre.Aliases == nil {
+		genre.Aliases = []string{}
+	}
+
+	v, err := app.Genre.Add(genre)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrDuplicateGenre):
+			v := validator.New()
+			v.AddError("slug", "the slug or one of the aliases already names a genre")
+			ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"genre": genre})
+}
+
+// MergeGenresHandler folds the source genres into the target genre, moving their
+// movies and keeping their names as aliases of the target.
+func MergeGenresHandler(c *gin.Context, app app.Application) {
+	var input struct {
+		Sources []string `json:"sources"`
+		Target  string   `json:"target"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	// Genres are named by slug, but accept any spelling of one.
+	input.Target = models.GenreSlug(input.Target)
+	for i, source := range input.Sources {
+		input.Sources[i] = models.GenreSlug(source)
+	}
+
+	v := validator.New()
+	if services.ValidateGenreMerge(v, input.Sources, input.Target); !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	changed, err := app.Genre.Merge(ContextGetUser(c).ID, input.Sources, input.Target)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "genres successfully merged", "movies_changed": changed})
+}
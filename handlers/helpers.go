@@ -3,13 +3,16 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/internal/models"
 	"github.com/rwx-yxu/greenlight/internal/validator"
+	"golang.org/x/text/language"
 )
 
 func ReadJSON(c *gin.Context, dst any) error {
@@ -40,11 +43,37 @@ func ReadJSON(c *gin.Context, dst any) error {
 	return nil
 }
 
+// ContextGetUser returns the user that the Authenticate middleware stored in the
+// request context, falling back to the AnonymousUser if there is none.
+func ContextGetUser(c *gin.Context) *models.User {
+	userVal, exists := c.Get("user")
+	if !exists {
+		return models.AnonymousUser
+	}
+	user, ok := userVal.(*models.User)
+	if !ok {
+		return models.AnonymousUser
+	}
+	return user
+}
+
+// ContextGetToken returns the plaintext bearer token that the Authenticate middleware
+// stored in the request context, or the empty string if the request had none.
+func ContextGetToken(c *gin.Context) string {
+	return c.GetString("token")
+}
+
 func ReadIDParam(c *gin.Context) (int64, error) {
+	return ReadNamedIDParam(c, "id")
+}
+
+// ReadNamedIDParam reads a positive integer ID from the named URL parameter, for
+// routes such as /v1/roles/:id/users/:user_id which carry more than one ID.
+func ReadNamedIDParam(c *gin.Context, name string) (int64, error) {
 
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -106,3 +135,34 @@ func ReadString(c *gin.Context, key string, defaultValue string) string {
 	// Otherwise return the string.
 	return s
 }
+
+// ReadBool reads a boolean value such as "true" or "0" from the query string, returning
+// the provided default value if no matching key could be found. If the value isn't a
+// boolean an error message is recorded in the provided Validator instance.
+func ReadBool(c *gin.Context, key string, defaultValue bool, v *validator.Validator) bool {
+	s := c.Query(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// ReadAcceptLanguage returns the languages in the request's Accept-Language header in
+// order of preference. A missing or malformed header gives no languages, in which case
+// responses aren't localised. As the response then depends on the header, it also adds
+// it to the Vary header.
+func ReadAcceptLanguage(c *gin.Context) []language.Tag {
+	c.Writer.Header().Add("Vary", "Accept-Language")
+	prefs, _, err := language.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+	if err != nil {
+		return nil
+	}
+	return prefs
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/app"
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/services"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// defaultMaxUploadSize is the largest image accepted if images.maxUploadSize isn't
+// configured.
+const defaultMaxUploadSize = 10 << 20
+
+// setImageURLs fills in the address of each variant of an image.
+func setImageURLs(img *models.Image) {
+	img.URLs = map[string]string{
+		models.ImageOriginal: fmt.Sprintf("/v1/images/%s/%s", img.Token, models.ImageOriginal),
+	}
+	for _, iv := range models.ImageVariants[img.Kind] {
+		img.URLs[iv.Name] = fmt.Sprintf("/v1/images/%s/%s", img.Token, iv.Name)
+	}
+}
+
+// readImageKind reads the kind of image from the URL, which is only found if it is a
+// poster or backdrop.
+func readImageKind(c *gin.Context) (string, error) {
+	kind := c.Param("kind")
+	v := validator.New()
+	if services.ValidateImageKind(v, kind); !v.Valid() {
+		return "", fmt.Errorf("invalid kind parameter")
+	}
+	return kind, nil
+}
+
+func ListMovieImagesHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	_, err = app.Movie.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	images, err := app.Image.FindAllForMovie(id)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	for _, img := range images {
+		setImageURLs(img)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"images": images})
+}
+
+// UploadMovieImageHandler sets a movie's poster or backdrop from the "file" field of a
+// multipart form, replacing any it already has. The type of the file is worked out
+// from its contents rather than trusted from the request.
+func UploadMovieImageHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+	kind, err := readImageKind(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	maxBytes := app.Config.Images.MaxUploadSize
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxUploadSize
+	}
+	// Leave some room for the multipart framing around the file itself.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+64<<10)
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			ErrorResponse(c, app, ContentTooLargeError(maxBytes))
+		default:
+			ErrorResponse(c, app, StatusBadRequestError(errors.New("body must be a multipart form with a file field")))
+		}
+		return
+	}
+	if fh.Size > maxBytes {
+		ErrorResponse(c, app, ContentTooLargeError(maxBytes))
+		return
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	defer file.Close()
+
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	contentType := http.DetectContentType(sniff[:n])
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		ErrorResponse(c, app, UnsupportedMediaTypeError(contentType))
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	img := &models.Image{
+		MovieID:     id,
+		Kind:        kind,
+		ContentType: contentType,
+	}
+
+	v, err := app.Image.Add(img, file)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	setImageURLs(img)
+
+	c.Header("Location", img.URLs[models.ImageOriginal])
+	c.JSON(http.StatusCreated, gin.H{"image": img})
+}
+
+func DeleteMovieImageHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+	kind, err := readImageKind(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	err = app.Image.Remove(id, kind)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "image successfully deleted"})
+}
+
+// ServeImageHandler sends one variant of an image, found by its token. A new upload
+// always gets a new image ID and token, so the files behind a URL never change and can
+// be cached indefinitely. Images of a movie in the trash aren't found.
+func ServeImageHandler(c *gin.Context, app app.Application) {
+	img, err := app.Image.FindByToken(c.Param("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	variant := c.Param("variant")
+	file, err := app.Image.Open(img, variant)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound), errors.Is(err, fs.ErrNotExist):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	contentType := "image/jpeg"
+	if variant == models.ImageOriginal {
+		contentType = img.ContentType
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", fmt.Sprintf(`"%d-%s"`, img.ID, variant))
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime(), file)
+}
@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/app"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/services"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+const (
+	// importMaxBytes is the largest import body we accept, and importMaxLineBytes the
+	// largest single NDJSON line, which matches the limit ReadJSON puts on a body.
+	importMaxBytes     = 64 << 20
+	importMaxLineBytes = 1 << 20
+
+	// importBatchSize is the number of valid rows created in each transaction.
+	importBatchSize = 100
+)
+
+// An ImportRow reports what happened to one row of an import. Row is the line number
+// in the body. ID is set once the movie has been created, and Errors if it wasn't
+// because the row was invalid or couldn't be read.
+type ImportRow struct {
+	Row    int               `json:"row"`
+	ID     int64             `json:"id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// An ImportRange is the rows of an import that failed when it was abandoned part way
+// through. Every row before From that has an ID was created, and no row from From on.
+type ImportRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+type ImportSummary struct {
+	Rows    int `json:"rows"`
+	Valid   int `json:"valid"`
+	Invalid int `json:"invalid"`
+	Created int `json:"created"`
+}
+
+// A rowError means a single row of an import couldn't be read. The rest of the body
+// can still be imported.
+type rowError map[string]string
+
+func (e rowError) Error() string {
+	return fmt.Sprintf("invalid row: %v", map[string]string(e))
+}
+
+// A movieRowReader returns the line number and movie of the next row of an import
+// body, or io.EOF once there are no rows left.
+type movieRowReader func() (int, *models.Movie, error)
+
+// ImportMoviesHandler creates movies in bulk from an NDJSON or CSV body, depending on
+// the Content-Type. The body is read a row at a time, so it is never held in memory
+// all at once, and the valid rows are created in batches of importBatchSize. If
+// dry_run is set each row is validated but nothing is created. A row giving an
+// external id which belongs to an existing movie, or which an earlier row gave, is
+// invalid like any other row.
+//
+// The response reports on every row. Each batch is committed on its own, so if the
+// body turns out to be unreadable or the database fails part way through, the rows in
+// earlier batches stay created and the import is abandoned with an error response.
+// That response still reports on every row read so far, along with the range of rows
+// that failed, so the client can tell which rows were created.
+func ImportMoviesHandler(c *gin.Context, app app.Application) {
+	v := validator.New()
+	dryRun := ReadBool(c, "dry_run", false, v)
+	if !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	// Push back the deadlines set by the server's ReadTimeout and WriteTimeout, which
+	// are too short to upload and report on a large catalogue.
+	rc := http.NewResponseController(c.Writer)
+	deadline := time.Now().Add(app.Config.Import.TimeoutDuration)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, importMaxBytes)
+
+	var next movieRowReader
+	switch c.ContentType() {
+	case "application/x-ndjson", "application/ndjson":
+		next = ndjsonMovieReader(body)
+	case "text/csv":
+		var err error
+		next, err = csvMovieReader(body)
+		if err != nil {
+			ErrorResponse(c, app, StatusBadRequestError(err))
+			return
+		}
+	default:
+		ErrorResponse(c, app, UnsupportedMediaTypeError(c.ContentType()))
+		return
+	}
+
+	// Every row's genres are resolved against the same copy of the taxonomy, rather
+	// than looking it up again for each row.
+	genres, err := app.Genre.FindLookup()
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	actorID := ContextGetUser(c).ID
+	rows := []*ImportRow{}
+	var summary ImportSummary
+	var batch []*models.Movie
+	var batchRows []*ImportRow
+	// seen holds the row which gave each external id in the body so far.
+	seen := make(map[models.ExternalID]int)
+
+	// flush creates the movies in the batch. Rows with an external id that already
+	// belongs to a movie are reported as invalid and left out first, so that they
+	// don't fail the whole batch, and so that a dry run reports them too.
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var ids []models.ExternalID
+		for _, movie := range batch {
+			ids = append(ids, externalIDs(movie)...)
+		}
+		if len(ids) > 0 {
+			used, err := app.Movie.FindUsedExternalIDs(ids)
+			if err != nil {
+				return err
+			}
+			var keep []*models.Movie
+			var keepRows []*ImportRow
+			for i, movie := range batch {
+				v := validator.New()
+				for _, id := range externalIDs(movie) {
+					if used[id] {
+						v.AddError("external_ids", fmt.Sprintf("%s id %s is already used by another movie", id.Source, id.ID))
+						break
+					}
+				}
+				if !v.Valid() {
+					batchRows[i].Errors = v.Errors
+					summary.Valid--
+					summary.Invalid++
+					continue
+				}
+				keep = append(keep, movie)
+				keepRows = append(keepRows, batchRows[i])
+			}
+			batch, batchRows = keep, keepRows
+		}
+		if !dryRun && len(batch) > 0 {
+			err := app.Movie.AddBatch(actorID, batch)
+			if err != nil {
+				return err
+			}
+			for i, movie := range batch {
+				batchRows[i].ID = movie.ID
+			}
+			summary.Created += len(batch)
+		}
+		batch, batchRows = nil, nil
+		return nil
+	}
+
+	// abort abandons the import with an error response that also reports on the rows
+	// read so far. The failed range starts at the first row that wasn't committed.
+	abort := func(err error, to int) {
+		failed := ImportRange{From: to, To: to}
+		if len(batchRows) > 0 {
+			failed.From = batchRows[0].Row
+		}
+		var he HandleError
+		if !errors.As(err, &he) {
+			he = HandleError{StatusCode: http.StatusInternalServerError}
+		}
+		app.LogError(c.Request, err)
+		c.JSON(he.StatusCode, gin.H{
+			"error":   he.Response,
+			"dry_run": dryRun,
+			"summary": summary,
+			"rows":    rows,
+			"failed":  failed,
+		})
+	}
+	// abortBatch abandons the import after the batch being flushed failed.
+	abortBatch := func(err error) {
+		to := batchRows[len(batchRows)-1].Row
+		if v := externalIDConflict(err); v != nil {
+			abort(FailedValidationResponse(v.Errors), to)
+			return
+		}
+		abort(InternalServerError(err), to)
+	}
+
+	for {
+		line, movie, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var re rowError
+		switch {
+		case errors.As(err, &re):
+			rows = append(rows, &ImportRow{Row: line, Errors: re})
+			summary.Rows++
+			summary.Invalid++
+			continue
+		case err != nil:
+			abort(StatusBadRequestError(TriageJSONError(err)), line)
+			return
+		}
+
+		row := &ImportRow{Row: line}
+		rows = append(rows, row)
+		summary.Rows++
+
+		v := app.Movie.Validate(*movie)
+		if v.Valid() {
+			movie.Genres = services.ResolveGenres(&v, "genres", movie.Genres, genres)
+		}
+		for _, id := range externalIDs(movie) {
+			if first, ok := seen[id]; ok {
+				v.AddError("external_ids", fmt.Sprintf("%s id %s is already given in row %d", id.Source, id.ID, first))
+				break
+			}
+		}
+		if !v.Valid() {
+			row.Errors = v.Errors
+			summary.Invalid++
+			continue
+		}
+		summary.Valid++
+		for _, id := range externalIDs(movie) {
+			seen[id] = line
+		}
+
+		batch = append(batch, movie)
+		batchRows = append(batchRows, row)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				abortBatch(err)
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		abortBatch(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dry_run": dryRun, "summary": summary, "rows": rows})
+}
+
+// externalIDs returns a movie's external ids, ordered by source.
+func externalIDs(movie *models.Movie) []models.ExternalID {
+	ids := make([]models.ExternalID, 0, len(movie.ExternalIDs))
+	for source, id := range movie.ExternalIDs {
+		ids = append(ids, models.ExternalID{Source: source, ID: id})
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Source < ids[j].Source })
+	return ids
+}
+
+// ndjsonMovieReader reads one movie per line, in the same JSON form accepted by
+// CreateMovieHandler. Blank lines are skipped.
+func ndjsonMovieReader(r io.Reader) movieRowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), importMaxLineBytes)
+	line := 0
+
+	return func() (int, *models.Movie, error) {
+		for scanner.Scan() {
+			line++
+			b := bytes.TrimSpace(scanner.Bytes())
+			if len(b) == 0 {
+				continue
+			}
+
+			var input struct {
+				Title       string            `json:"title"`
+				Year        int32             `json:"year"`
+				Runtime     models.Runtime    `json:"runtime"`
+				Genres      []string          `json:"genres"`
+				ExternalIDs map[string]string `json:"external_ids"`
+			}
+			dec := json.NewDecoder(bytes.NewReader(b))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&input); err != nil {
+				return line, nil, rowError{"body": TriageJSONError(err).Error()}
+			}
+			if dec.More() {
+				return line, nil, rowError{"body": "line must only contain a single JSON value"}
+			}
+
+			models.NormaliseExternalIDs(input.ExternalIDs)
+
+			return line, &models.Movie{
+				Title:       input.Title,
+				Year:        input.Year,
+				Runtime:     input.Runtime,
+				Genres:      input.Genres,
+				ExternalIDs: input.ExternalIDs,
+			}, nil
+		}
+		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				return line + 1, nil, fmt.Errorf("line %d is longer than %d bytes", line+1, importMaxLineBytes)
+			}
+			return line, nil, err
+		}
+		return line, nil, io.EOF
+	}
+}
+
+// csvMovieReader reads one movie per record. The first record is a header naming the
+// columns, which may be any of title, year, runtime and genres in any order. Runtime
+// is either a number of minutes or "<runtime> mins", and genres are separated by
+// commas, so a movie with more than one genre needs its genres field quoted.
+func csvMovieReader(r io.Reader) (movieRowReader, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, TriageJSONError(err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "title", "year", "runtime", "genres":
+		default:
+			return nil, fmt.Errorf("body contains unknown column %q", name)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("body contains duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+
+	return func() (int, *models.Movie, error) {
+		record, err := cr.Read()
+		var pe *csv.ParseError
+		switch {
+		case errors.As(err, &pe):
+			// The csv package carries on from the next record after a parse error,
+			// so only this row is lost.
+			return pe.StartLine, nil, rowError{"body": pe.Err.Error()}
+		case err != nil:
+			return 0, nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		movie := &models.Movie{Title: field("title")}
+		errs := rowError{}
+
+		if s := field("year"); s != "" {
+			year, err := strconv.ParseInt(s, 10, 32)
+			if err != nil {
+				errs["year"] = "must be an integer value"
+			}
+			movie.Year = int32(year)
+		}
+		if s := field("runtime"); s != "" {
+			minutes, err := strconv.ParseInt(s, 10, 32)
+			if err == nil {
+				movie.Runtime = models.Runtime(minutes)
+			} else if err := movie.Runtime.UnmarshalJSON([]byte(strconv.Quote(s))); err != nil {
+				errs["runtime"] = "must be a number of minutes or in the format \"<runtime> mins\""
+			}
+		}
+		if s := field("genres"); s != "" {
+			movie.Genres = []string{}
+			for _, genre := range strings.Split(s, ",") {
+				if genre = strings.TrimSpace(genre); genre != "" {
+					movie.Genres = append(movie.Genres, genre)
+				}
+			}
+		}
+
+		if len(errs) > 0 {
+			return line, nil, errs
+		}
+		return line, movie, nil
+	}, nil
+}
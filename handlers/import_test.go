@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+// importResult is what a movieRowReader returned for one row.
+type importResult struct {
+	line  int
+	movie *models.Movie
+	errs  rowError
+}
+
+// readRows returns everything a movieRowReader returns up to io.EOF, failing the test
+// on any error that isn't a rowError.
+func readRows(t *testing.T, next movieRowReader) []importResult {
+	t.Helper()
+	var results []importResult
+	for {
+		line, movie, err := next()
+		if errors.Is(err, io.EOF) {
+			return results
+		}
+		var re rowError
+		if err != nil && !errors.As(err, &re) {
+			t.Fatalf("line %d: %v", line, err)
+		}
+		results = append(results, importResult{line, movie, re})
+	}
+}
+
+func TestNDJSONMovieReader(t *testing.T) {
+	body := `{"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation","adventure"]}
+
+{"title":"Casablanca","year":1942,"runtime":"102 mins","genres":["drama"],"external_ids":{"imdb":"TT0034583"}}
+{"title":"Extra","director":"Someone"}
+{"title":
+{"title":"One"} {"title":"Two"}
+`
+	results := readRows(t, ndjsonMovieReader(strings.NewReader(body)))
+
+	want := []importResult{
+		{line: 1, movie: &models.Movie{
+			Title:   "Moana",
+			Year:    2016,
+			Runtime: 107,
+			Genres:  []string{"animation", "adventure"},
+		}},
+		{line: 3, movie: &models.Movie{
+			Title:       "Casablanca",
+			Year:        1942,
+			Runtime:     102,
+			Genres:      []string{"drama"},
+			ExternalIDs: map[string]string{"imdb": "tt0034583"},
+		}},
+		{line: 4, errs: rowError{"body": `body contains unknown key "director"`}},
+		{line: 5, errs: rowError{"body": "body contains badly-formed JSON"}},
+		{line: 6, errs: rowError{"body": "line must only contain a single JSON value"}},
+	}
+
+	if len(results) != len(want) {
+		t.Fatalf("got %d rows; want %d: %+v", len(results), len(want), results)
+	}
+	for i := range want {
+		got := results[i]
+		if got.line != want[i].line {
+			t.Errorf("row %d: line = %d; want %d", i, got.line, want[i].line)
+		}
+		if !reflect.DeepEqual(got.movie, want[i].movie) {
+			t.Errorf("line %d: movie = %+v; want %+v", got.line, got.movie, want[i].movie)
+		}
+		if want[i].errs != nil && got.errs == nil {
+			t.Errorf("line %d: no error; want %v", got.line, want[i].errs)
+		}
+	}
+}
+
+func TestCSVMovieReader(t *testing.T) {
+	body := `Genres,Title,Year,Runtime
+"drama, romance",Casablanca,1942,102
+animation,Moana,2016,107 mins
+drama,Broken,nineteen,long
+,Untitled,,
+`
+	next, err := csvMovieReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := readRows(t, next)
+
+	want := []importResult{
+		{line: 2, movie: &models.Movie{Title: "Casablanca", Year: 1942, Runtime: 102, Genres: []string{"drama", "romance"}}},
+		{line: 3, movie: &models.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}}},
+		{line: 4, errs: rowError{
+			"year":    "must be an integer value",
+			"runtime": "must be a number of minutes or in the format \"<runtime> mins\"",
+		}},
+		{line: 5, movie: &models.Movie{Title: "Untitled"}},
+	}
+
+	if len(results) != len(want) {
+		t.Fatalf("got %d rows; want %d: %+v", len(results), len(want), results)
+	}
+	for i := range want {
+		got := results[i]
+		if got.line != want[i].line {
+			t.Errorf("row %d: line = %d; want %d", i, got.line, want[i].line)
+		}
+		if !reflect.DeepEqual(got.movie, want[i].movie) {
+			t.Errorf("line %d: movie = %+v; want %+v", got.line, got.movie, want[i].movie)
+		}
+		if !reflect.DeepEqual(got.errs, want[i].errs) {
+			t.Errorf("line %d: errors = %v; want %v", got.line, got.errs, want[i].errs)
+		}
+	}
+}
+
+func TestCSVMovieReaderHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"empty", ""},
+		{"unknown column", "title,director\n"},
+		{"duplicate column", "title,Title\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := csvMovieReader(strings.NewReader(tt.body)); err == nil {
+				t.Error("csvMovieReader returned no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/app"
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// listWriteError sends the response for an error returned when saving a list or its
+// items.
+func listWriteError(c *gin.Context, app app.Application, err error) {
+	v := validator.New()
+	switch {
+	case errors.Is(err, brokers.ErrDuplicateListName):
+		v.AddError("name", "you already have a list with this name")
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+	case errors.Is(err, brokers.ErrDuplicateListItem):
+		v.AddError("movie_id", "is already on this list")
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+	case errors.Is(err, brokers.ErrInvalidListOrder):
+		v.AddError("movie_ids", "must contain every movie on the list exactly once")
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+	case errors.Is(err, brokers.ErrRecordNotFound):
+		ErrorResponse(c, app, NotFoundError(err))
+	case errors.Is(err, brokers.ErrEditConflict):
+		ErrorResponse(c, app, EditConflictError(err))
+	default:
+		ErrorResponse(c, app, InternalServerError(err))
+	}
+}
+
+// ownList returns the list named in the URL if it belongs to the current user.
+// Otherwise it sends an error response and returns nil. Other users' lists are
+// reported as not found, so that their ids don't give away which lists exist.
+func ownList(c *gin.Context, app app.Application) *models.List {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return nil
+	}
+
+	list, err := app.List.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return nil
+	}
+	if list.UserID != ContextGetUser(c).ID {
+		ErrorResponse(c, app, NotFoundError(nil))
+		return nil
+	}
+
+	return list
+}
+
+// ListListsHandler lists the current user's lists, starting with their watchlist.
+func ListListsHandler(c *gin.Context, app app.Application) {
+	lists, err := app.List.FindAllForUser(ContextGetUser(c).ID)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"lists": lists})
+}
+
+func CreateListHandler(c *gin.Context, app app.Application) {
+	var input struct {
+		Name   string `json:"name"`
+		Public bool   `json:"public"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	list := &models.List{
+		UserID: ContextGetUser(c).ID,
+		Name:   input.Name,
+		Public: input.Public,
+	}
+
+	v, err := app.List.Add(list)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		listWriteError(c, app, err)
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/v1/lists/%d", list.ID))
+	c.JSON(http.StatusCreated, gin.H{"list": list})
+}
+
+// ShowListHandler returns one of the current user's lists with its movies in order.
+func ShowListHandler(c *gin.Context, app app.Application) {
+	list := ownList(c, app)
+	if list == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"list": list})
+}
+
+// ShowPublicListHandler returns a shared list by its slug. It can be read by anyone,
+// including anonymous users.
+func ShowPublicListHandler(c *gin.Context, app app.Application) {
+	list, err := app.List.FindBySlug(c.Param("slug"))
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"list": list})
+}
+
+// UpdateListHandler renames a list or shares it. Making a list public gives it a slug
+// that can be passed to ShowPublicListHandler.
+func UpdateListHandler(c *gin.Context, app app.Application) {
+	list := ownList(c, app)
+	if list == nil {
+		return
+	}
+
+	var input struct {
+		Name   *string `json:"name"`
+		Public *bool   `json:"public"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+	if input.Public != nil {
+		list.Public = *input.Public
+	}
+
+	v, err := app.List.Edit(list)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		listWriteError(c, app, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"list": list})
+}
+
+// DeleteListHandler deletes one of the current user's lists. The watchlist can't be
+// deleted, only emptied.
+func DeleteListHandler(c *gin.Context, app app.Application) {
+	list := ownList(c, app)
+	if list == nil {
+		return
+	}
+	if list.Watchlist {
+		v := validator.New()
+		v.AddError("id", "the watchlist can't be deleted")
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	err := app.List.RemoveByID(list.ID)
+	if err != nil {
+		listWriteError(c, app, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "list successfully deleted"})
+}
+
+// AddListItemHandler adds a movie to the end of a list.
+func AddListItemHandler(c *gin.Context, app app.Application) {
+	list := ownList(c, app)
+	if list == nil {
+		return
+	}
+
+	var input struct {
+		MovieID int64 `json:"movie_id"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	item, err := app.List.AddItem(list.ID, input.MovieID)
+	if err != nil {
+		listWriteError(c, app, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"item": item})
+}
+
+func DeleteListItemHandler(c *gin.Context, app app.Application) {
+	list := ownList(c, app)
+	if list == nil {
+		return
+	}
+	movieID, err := ReadNamedIDParam(c, "movie_id")
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	err = app.List.RemoveItem(list.ID, movieID)
+	if err != nil {
+		listWriteError(c, app, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "movie successfully removed from list"})
+}
+
+// ReorderListItemsHandler puts the movies on a list into a new order, given as the
+// ids of every movie on the list.
+func ReorderListItemsHandler(c *gin.Context, app app.Application) {
+	list := ownList(c, app)
+	if list == nil {
+		return
+	}
+
+	var input struct {
+		MovieIDs []int64 `json:"movie_ids"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	v, err := app.List.ReorderItems(list.ID, input.MovieIDs)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		listWriteError(c, app, err)
+		return
+	}
+
+	list, err = app.List.FindByID(list.ID)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"list": list})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,15 +11,17 @@ import (
 	"github.com/rwx-yxu/greenlight/internal/brokers"
 	"github.com/rwx-yxu/greenlight/internal/filter"
 	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/services"
 	"github.com/rwx-yxu/greenlight/internal/validator"
 )
 
 func CreateMovieHandler(c *gin.Context, app app.Application) {
 	var input struct {
-		Title   string         `json:"title"`
-		Year    int32          `json:"year"`
-		Runtime models.Runtime `json:"runtime"`
-		Genres  []string       `json:"genres"`
+		Title       string            `json:"title"`
+		Year        int32             `json:"year"`
+		Runtime     models.Runtime    `json:"runtime"`
+		Genres      []string          `json:"genres"`
+		ExternalIDs map[string]string `json:"external_ids"`
 	}
 	if err := ReadJSON(c, &input); err != nil {
 		ErrorResponse(c, app, StatusBadRequestError(err))
@@ -26,17 +29,22 @@ func CreateMovieHandler(c *gin.Context, app app.Application) {
 	}
 
 	m := &models.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:       input.Title,
+		Year:        input.Year,
+		Runtime:     input.Runtime,
+		Genres:      input.Genres,
+		ExternalIDs: input.ExternalIDs,
 	}
 
-	v, err := app.Movie.Add(m)
+	v, err := app.Movie.Add(ContextGetUser(c).ID, m)
 	if v != nil {
 		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
 		return
 	}
+	if v := externalIDConflict(err); v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
 	if err != nil {
 		ErrorResponse(c, app, StatusBadRequestError(err))
 		return
@@ -50,6 +58,18 @@ func CreateMovieHandler(c *gin.Context, app app.Application) {
 
 }
 
+// externalIDConflict returns the validation error to report when a movie was given
+// an external id that belongs to another movie, or nil if err is something else.
+func externalIDConflict(err error) *validator.Validator {
+	var dup *brokers.DuplicateExternalIDError
+	if !errors.As(err, &dup) {
+		return nil
+	}
+	v := validator.New()
+	v.AddError("external_ids", fmt.Sprintf("%s id %s is already used by another movie", dup.Source, dup.ExternalID))
+	return v
+}
+
 func ShowMovieHandler(c *gin.Context, app app.Application) {
 	id, err := ReadIDParam(c)
 	if err != nil {
@@ -68,6 +88,39 @@ func ShowMovieHandler(c *gin.Context, app app.Application) {
 		return
 	}
 
+	// Credits and alternate titles are only included on request, as most clients
+	// showing a movie don't need the full cast or every translation.
+	include := ReadCSV(c, "include", []string{})
+	if validator.PermittedValue("credits", include...) {
+		movie.Credits, err = app.Credit.FindAllForMovie(movie.ID)
+		if err != nil {
+			ErrorResponse(c, app, InternalServerError(err))
+			return
+		}
+	}
+	if validator.PermittedValue("titles", include...) {
+		movie.Titles, err = app.Title.FindAllForMovie(movie.ID)
+		if err != nil {
+			ErrorResponse(c, app, InternalServerError(err))
+			return
+		}
+	}
+
+	err = app.Title.Localise([]*models.Movie{movie}, ReadAcceptLanguage(c))
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	movie.Collection, err = app.Collection.FindForMovie(movie.ID)
+	if err != nil && !errors.Is(err, brokers.ErrRecordNotFound) {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	if NotModified(c, MovieDetailETag(movie)) {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"movie": movie})
 }
 
@@ -87,11 +140,19 @@ func UpdateMovieHandler(c *gin.Context, app app.Application) {
 		}
 		return
 	}
+	// Refuse the update before reading the body if the client's copy is out of date.
+	// The update itself is conditional on the version we just read, so the row can't
+	// change between this check and the write.
+	if !MoviePreconditionHolds(c, movie) {
+		ErrorResponse(c, app, PreconditionFailedError())
+		return
+	}
 	var input struct {
-		Title   *string         `json:"title"`
-		Year    *int32          `json:"year"`
-		Runtime *models.Runtime `json:"runtime"`
-		Genres  []string        `json:"genres"`
+		Title       *string           `json:"title"`
+		Year        *int32            `json:"year"`
+		Runtime     *models.Runtime   `json:"runtime"`
+		Genres      []string          `json:"genres"`
+		ExternalIDs map[string]string `json:"external_ids"`
 	}
 	if err := ReadJSON(c, &input); err != nil {
 		ErrorResponse(c, app, StatusBadRequestError(err))
@@ -117,14 +178,25 @@ func UpdateMovieHandler(c *gin.Context, app app.Application) {
 	if input.Genres != nil {
 		movie.Genres = input.Genres // Note that we don't need to dereference a slice.
 	}
+	// The external ids given replace all of the movie's existing ones, so an empty
+	// object removes them.
+	if input.ExternalIDs != nil {
+		movie.ExternalIDs = input.ExternalIDs
+	}
 
-	v, err := app.Movie.Edit(movie)
+	v, err := app.Movie.Edit(ContextGetUser(c).ID, movie)
 	if v != nil {
 		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
 		return
 	}
+	if v := externalIDConflict(err); v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
 	if err != nil {
 		switch {
+		case errors.Is(err, brokers.ErrEditConflict) && c.GetHeader("If-Match") != "":
+			ErrorResponse(c, app, PreconditionFailedError())
 		case errors.Is(err, brokers.ErrEditConflict):
 			ErrorResponse(c, app, EditConflictError(err))
 		default:
@@ -132,6 +204,7 @@ func UpdateMovieHandler(c *gin.Context, app app.Application) {
 		}
 		return
 	}
+	c.Header("ETag", MovieETag(movie))
 	c.JSON(http.StatusOK, gin.H{"movie": movie})
 }
 
@@ -143,9 +216,41 @@ func DeleteMovieHandler(c *gin.Context, app app.Application) {
 		return
 	}
 
+	// If the client sent If-Match, only delete the movie if it is still at the
+	// version the client has. Deleting by id and version means a concurrent update
+	// between the check and the delete also fails the precondition.
+	if c.GetHeader("If-Match") != "" {
+		movie, err := app.Movie.FindByID(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, brokers.ErrRecordNotFound):
+				ErrorResponse(c, app, NotFoundError(err))
+			default:
+				ErrorResponse(c, app, InternalServerError(err))
+			}
+			return
+		}
+		if !MoviePreconditionHolds(c, movie) {
+			ErrorResponse(c, app, PreconditionFailedError())
+			return
+		}
+		err = app.Movie.RemoveByIDAndVersion(ContextGetUser(c).ID, id, movie.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, brokers.ErrEditConflict):
+				ErrorResponse(c, app, PreconditionFailedError())
+			default:
+				ErrorResponse(c, app, InternalServerError(err))
+			}
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "movie successfully deleted"})
+		return
+	}
+
 	// Delete the movie from the database, sending a 404 Not Found response to the
 	// client if there isn't a matching record.
-	err = app.Movie.RemoveByID(id)
+	err = app.Movie.RemoveByID(ContextGetUser(c).ID, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, brokers.ErrRecordNotFound):
@@ -160,15 +265,8 @@ func DeleteMovieHandler(c *gin.Context, app app.Application) {
 }
 
 func ListMoviesHandler(c *gin.Context, app app.Application) {
-	var input struct {
-		Title  string
-		Genres []string
-		filter.Filter
-	}
-
 	v := validator.New()
-	input.Title = ReadString(c, "title", "")
-	input.Genres = ReadCSV(c, "genres", []string{})
+	input := ReadMovieFilter(c, v)
 
 	// Get the page and page_size query string values as integers. Notice that we set
 	// the default page value to 1 and default page_size to 20, and that we pass the
@@ -176,21 +274,337 @@ func ListMoviesHandler(c *gin.Context, app app.Application) {
 	input.Page = ReadInt(c, "page", 1, v)
 	input.PageSize = ReadInt(c, "page_size", 20, v)
 
-	// Extract the sort query string value, falling back to "id" if it is not provided
-	// by the client (which will imply a ascending sort on movie ID).
-	input.Sort = ReadString(c, "sort", "id")
-	input.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	// The presence of a cursor parameter, even an empty one for the first page,
+	// switches the list from page numbers to keyset pagination.
+	input.Cursor, input.UseCursor = c.GetQuery("cursor")
+
 	// Check the Validator instance for any errors and use the failedValidationResponse()
 	// helper to send the client a response if necessary.
-	if input.Filter.Validate(v); !v.Valid() {
+	if input.Validate(v); !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	movies, metadata, err := app.Movie.FindAll(input)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	err = app.Title.Localise(movies, ReadAcceptLanguage(c))
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	if NotModified(c, MovieListETag(movies)) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"movies": movies, "metadata": metadata})
+}
+
+// ReadMovieFilter reads the search, filter and sort parameters shared by the movie
+// list and export from the query string. Pagination is left to the caller.
+func ReadMovieFilter(c *gin.Context, v *validator.Validator) filter.MovieFilter {
+	var input filter.MovieFilter
+
+	input.Title = ReadString(c, "title", "")
+	input.Q = ReadString(c, "q", "")
+	input.Genres = ReadCSV(c, "genres", []string{})
+	input.GenresAny = ReadCSV(c, "genres_any", []string{})
+	input.ExcludeGenres = ReadCSV(c, "exclude_genres", []string{})
+
+	// A range bound of zero means the bound isn't applied.
+	input.YearMin = ReadInt(c, "year_min", 0, v)
+	input.YearMax = ReadInt(c, "year_max", 0, v)
+	input.RuntimeMin = ReadInt(c, "runtime_min", 0, v)
+	input.RuntimeMax = ReadInt(c, "runtime_max", 0, v)
+	input.PersonID = int64(ReadInt(c, "person", 0, v))
+	input.CollectionID = int64(ReadInt(c, "collection", 0, v))
+
+	// Extract the sort query string value, falling back to "id" if it is not provided
+	// by the client (which will imply a ascending sort on movie ID). A search query
+	// falls back to the best matches first instead.
+	defaultSort := "id"
+	if input.Q != "" {
+		defaultSort = "-rank"
+	}
+	input.Sort = ReadString(c, "sort", defaultSort)
+	input.SortSafeList = []string{"id", "title", "year", "runtime", "rank", "rating", "-id", "-title", "-year", "-runtime", "-rank", "-rating"}
+
+	return input
+}
+
+// SuggestMoviesHandler returns the titles most similar to the q parameter, for
+// autocomplete and "did you mean" prompts. Unlike the q search on the list endpoint it
+// tolerates typos, at the cost of a less precise match.
+func SuggestMoviesHandler(c *gin.Context, app app.Application) {
+	v := validator.New()
+	q := ReadString(c, "q", "")
+	limit := ReadInt(c, "limit", 10, v)
+
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 200, "q", "must not be more than 200 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 20, "limit", "must be a maximum of 20")
+	if !v.Valid() {
 		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
 		return
 	}
 
-	movies, metadata, err := app.Movie.FindAll(input.Title, input.Genres, input.Filter)
+	// Fall back to a fairly lenient threshold if none is configured, so that a
+	// badly misspelt title still finds something.
+	threshold := app.Config.Suggest.Threshold
+	if threshold <= 0 || threshold > 1 {
+		threshold = 0.3
+	}
+
+	suggestions, err := app.Movie.FindSuggestions(q, threshold, limit)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// LookupMovieHandler finds the movie with an identifier from another system, such as
+// ?source=imdb&id=tt0111161, so that clients syncing with it needn't match by title.
+func LookupMovieHandler(c *gin.Context, app app.Application) {
+	v := validator.New()
+	source := ReadString(c, "source", "")
+	id := models.NormaliseExternalID(source, ReadString(c, "id", ""))
+
+	v.Check(source != "", "source", "must be provided")
+	v.Check(id != "", "id", "must be provided")
+	if _, ok := models.ExternalIDRX[source]; source != "" && !ok {
+		v.AddError("source", fmt.Sprintf("%q is not a supported source", source))
+	}
+	if v.Valid() {
+		services.ValidateExternalID(v, "id", source, id)
+	}
+	if !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	movie, err := app.Movie.FindByExternalID(source, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	err = app.Title.Localise([]*models.Movie{movie}, ReadAcceptLanguage(c))
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	if NotModified(c, MovieDetailETag(movie)) {
+		return
+	}
+	c.Header("Content-Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	c.JSON(http.StatusOK, gin.H{"movie": movie})
+}
+
+// ListTrashedMoviesHandler lists the movies that have been deleted but not yet purged,
+// most recently deleted first by default.
+func ListTrashedMoviesHandler(c *gin.Context, app app.Application) {
+	var input filter.Filter
+
+	v := validator.New()
+	input.Page = ReadInt(c, "page", 1, v)
+	input.PageSize = ReadInt(c, "page_size", 20, v)
+	input.Sort = ReadString(c, "sort", "-deleted_at")
+	input.SortSafeList = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+	if input.Validate(v); !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	movies, metadata, err := app.Movie.FindAllDeleted(input)
 	if err != nil {
 		ErrorResponse(c, app, InternalServerError(err))
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"movies": movies, "metadata": metadata})
 }
+
+// RestoreMovieHandler takes a movie back out of the trash.
+func RestoreMovieHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	movie, err := app.Movie.Restore(ContextGetUser(c).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.Header("ETag", MovieETag(movie))
+	c.JSON(http.StatusOK, gin.H{"movie": movie})
+}
+
+// PurgeMovieHandler permanently deletes a movie that is already in the trash.
+func PurgeMovieHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	// The image rows go along with the movie, so read them first in order to remove
+	// their files once it has been purged.
+	images, err := app.Image.FindAllForMovie(id)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	err = app.Movie.Purge(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	for _, img := range images {
+		if err := app.Image.RemoveFiles(img); err != nil {
+			app.LogError(c.Request, err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "movie successfully purged"})
+}
+
+// ListMovieRevisionsHandler lists the changes made to a movie, newest first by default.
+func ListMovieRevisionsHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	_, err = app.Movie.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	var input filter.Filter
+
+	v := validator.New()
+	input.Page = ReadInt(c, "page", 1, v)
+	input.PageSize = ReadInt(c, "page_size", 20, v)
+	input.Sort = ReadString(c, "sort", "-version")
+	input.SortSafeList = []string{"version", "-version"}
+	if input.Validate(v); !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	revisions, metadata, err := app.Movie.FindRevisions(id, input)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions, "metadata": metadata})
+}
+
+// RollbackMovieHandler puts a movie back the way it was at an earlier version. The
+// rollback is an ordinary update, so it is validated like any other and recorded as a
+// new revision rather than discarding the ones in between.
+//
+// Only the title, year, runtime and genres are rolled back. The movie keeps its
+// current external ids, as they say which movie this is in other systems rather than
+// describing it, and an old id may since have been given to another movie. They can
+// still be changed with an ordinary update.
+func RollbackMovieHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+	version, err := ReadNamedIDParam(c, "version")
+	if err != nil || version > math.MaxInt32 {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	movie, err := app.Movie.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	if !MoviePreconditionHolds(c, movie) {
+		ErrorResponse(c, app, PreconditionFailedError())
+		return
+	}
+
+	revision, err := app.Movie.FindRevision(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	// A delete revision has no state to go back to.
+	if revision.After == nil {
+		v := validator.New()
+		v.AddError("version", "has no movie state to restore")
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	movie.Title = revision.After.Title
+	movie.Year = revision.After.Year
+	movie.Runtime = revision.After.Runtime
+	movie.Genres = revision.After.Genres
+
+	v, err := app.Movie.Edit(ContextGetUser(c).ID, movie)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if v := externalIDConflict(err); v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrEditConflict) && c.GetHeader("If-Match") != "":
+			ErrorResponse(c, app, PreconditionFailedError())
+		case errors.Is(err, brokers.ErrEditConflict):
+			ErrorResponse(c, app, EditConflictError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.Header("ETag", MovieETag(movie))
+	c.JSON(http.StatusOK, gin.H{"movie": movie})
+}
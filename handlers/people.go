@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/app"
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// ShowPersonHandler returns a person along with their filmography.
+func ShowPersonHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	person, err := app.Person.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	person.Filmography, err = app.Credit.FindAllForPerson(person.ID)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"person": person})
+}
+
+func CreatePersonHandler(c *gin.Context, app app.Application) {
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	person := &models.Person{Name: input.Name}
+
+	v, err := app.Person.Add(person)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/v1/people/%d", person.ID))
+	c.JSON(http.StatusCreated, gin.H{"person": person})
+}
+
+func UpdatePersonHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	person, err := app.Person.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	var input struct {
+		Name *string `json:"name"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+	if input.Name != nil {
+		person.Name = *input.Name
+	}
+
+	v, err := app.Person.Edit(person)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrEditConflict):
+			ErrorResponse(c, app, EditConflictError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"person": person})
+}
+
+// DeletePersonHandler deletes a person and removes them from the credits of every
+// movie they worked on.
+func DeletePersonHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	err = app.Person.RemoveByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "person successfully deleted"})
+}
+
+// CreateCreditHandler credits a person on a movie.
+func CreateCreditHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	var input struct {
+		PersonID  int64  `json:"person_id"`
+		Role      string `json:"role"`
+		Character string `json:"character"`
+		Billing   int    `json:"billing"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	credit := &models.Credit{
+		MovieID:   id,
+		PersonID:  input.PersonID,
+		Role:      input.Role,
+		Character: input.Character,
+		Billing:   input.Billing,
+	}
+
+	v, err := app.Credit.Add(credit)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		v := validator.New()
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		case errors.Is(err, brokers.ErrUnknownPerson):
+			v.AddError("person_id", "must be the id of an existing person")
+			ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		case errors.Is(err, brokers.ErrDuplicateCredit):
+			v.AddError("person_id", "already has this credit on the movie")
+			ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"credit": credit})
+}
+
+func DeleteCreditHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+	creditID, err := ReadNamedIDParam(c, "credit_id")
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	err = app.Credit.Remove(id, creditID)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "credit successfully deleted"})
+}
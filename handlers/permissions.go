@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/app"
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/services"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+func ListUserPermissionsHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	perms, err := app.Permission.FindAllForUser(id)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"permissions": perms})
+}
+
+func ListUserPermissionHistoryHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	changes, err := app.Permission.FindHistoryForUser(id)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": changes})
+}
+
+func GrantUserPermissionsHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	var input struct {
+		Codes []string `json:"codes"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	v := validator.New()
+	if services.ValidatePermissionCodes(v, input.Codes); !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	actor := ContextGetUser(c)
+	err = app.Permission.GrantForUser(actor.ID, id, input.Codes...)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrUnknownPermission):
+			v.AddError("codes", "must only contain known permission codes")
+			ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	ListUserPermissionsHandler(c, app)
+}
+
+func RevokeUserPermissionHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	actor := ContextGetUser(c)
+	err = app.Permission.RevokeForUser(actor.ID, id, c.Param("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrUnknownPermission):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	ListUserPermissionsHandler(c, app)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/app"
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/filter"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/services"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// readReviewFilter reads the pagination and sort parameters for a list of reviews.
+func readReviewFilter(c *gin.Context, v *validator.Validator, defaultSort string) filter.Filter {
+	var input filter.Filter
+
+	input.Page = ReadInt(c, "page", 1, v)
+	input.PageSize = ReadInt(c, "page_size", 20, v)
+	input.Sort = ReadString(c, "sort", defaultSort)
+	input.SortSafeList = []string{"id", "created_at", "updated_at", "-id", "-created_at", "-updated_at"}
+	input.Validate(v)
+
+	return input
+}
+
+// ListMovieReviewsHandler lists the approved reviews of a movie, newest first by
+// default, along with the current user's own review whatever its status.
+func ListMovieReviewsHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	v := validator.New()
+	input := readReviewFilter(c, v, "-created_at")
+	if !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	// Check the movie exists, so that a missing movie isn't mistaken for one without
+	// any reviews.
+	_, err = app.Movie.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	reviews, metadata, err := app.Review.FindAllForMovie(id, ContextGetUser(c).ID, input)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reviews": reviews, "metadata": metadata})
+}
+
+// CreateReviewHandler adds the current user's review of a movie. It is pending until
+// a moderator approves it.
+func CreateReviewHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	review := &models.Review{
+		MovieID: id,
+		UserID:  ContextGetUser(c).ID,
+		Body:    input.Body,
+	}
+
+	v, err := app.Review.Add(review)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		case errors.Is(err, brokers.ErrDuplicateReview):
+			v := validator.New()
+			v.AddError("movie_id", "you have already reviewed this movie")
+			ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/v1/movies/%d/reviews/%d", review.MovieID, review.ID))
+	c.JSON(http.StatusCreated, gin.H{"review": review})
+}
+
+// authorReview returns the review named in the URL if it belongs to the movie in the
+// URL and was written by the current user. Otherwise it sends an error response and
+// returns nil.
+func authorReview(c *gin.Context, app app.Application) *models.Review {
+	movieID, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return nil
+	}
+	id, err := ReadNamedIDParam(c, "review_id")
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return nil
+	}
+
+	review, err := app.Review.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return nil
+	}
+	if review.MovieID != movieID {
+		ErrorResponse(c, app, NotFoundError(nil))
+		return nil
+	}
+	if review.UserID != ContextGetUser(c).ID {
+		ErrorResponse(c, app, NotPermitted())
+		return nil
+	}
+
+	return review
+}
+
+// UpdateReviewHandler lets the author of a review change its text, which sends it back
+// for moderation.
+func UpdateReviewHandler(c *gin.Context, app app.Application) {
+	review := authorReview(c, app)
+	if review == nil {
+		return
+	}
+
+	var input struct {
+		Body *string `json:"body"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+
+	v, err := app.Review.Edit(review)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrEditConflict):
+			ErrorResponse(c, app, EditConflictError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"review": review})
+}
+
+// DeleteReviewHandler lets the author of a review delete it.
+func DeleteReviewHandler(c *gin.Context, app app.Application) {
+	review := authorReview(c, app)
+	if review == nil {
+		return
+	}
+
+	err := app.Review.RemoveByID(review.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "review successfully deleted"})
+}
+
+// ListReviewsForModerationHandler lists the reviews of every movie with a given status,
+// by default the pending ones, oldest first.
+func ListReviewsForModerationHandler(c *gin.Context, app app.Application) {
+	v := validator.New()
+	status := ReadString(c, "status", models.ReviewPending)
+	services.ValidateReviewStatus(v, status)
+	input := readReviewFilter(c, v, "created_at")
+	if !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	reviews, metadata, err := app.Review.FindAllByStatus(status, input)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reviews": reviews, "metadata": metadata})
+}
+
+// ModerateReviewHandler sets the moderation status of a review.
+func ModerateReviewHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	review, err := app.Review.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	moderatorID := ContextGetUser(c).ID
+	review.Status = input.Status
+	review.ModeratedBy = &moderatorID
+
+	v, err := app.Review.Moderate(review)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrEditConflict):
+			ErrorResponse(c, app, EditConflictError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"review": review})
+}
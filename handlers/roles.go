@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwx-yxu/greenlight/app"
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// roleWriteError sends the response for an error returned when inserting or updating
+// a role. Duplicate names and unknown permission codes are problems with the client's
+// input, so they are reported as validation failures.
+func roleWriteError(c *gin.Context, app app.Application, err error) {
+	v := validator.New()
+	switch {
+	case errors.Is(err, brokers.ErrDuplicateRoleName):
+		v.AddError("name", "a role with this name already exists")
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+	case errors.Is(err, brokers.ErrUnknownPermission):
+		v.AddError("permissions", "must only contain known permission codes")
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+	case errors.Is(err, brokers.ErrEditConflict):
+		ErrorResponse(c, app, EditConflictError(err))
+	default:
+		ErrorResponse(c, app, InternalServerError(err))
+	}
+}
+
+// unheldPermissions returns the codes which the user doesn't hold. A role can only
+// bundle, and only be assigned by, someone holding every permission it grants, so
+// that roles:admin can't be used to escalate to any other permission.
+func unheldPermissions(app app.Application, userID int64, codes []string) ([]string, error) {
+	perms, err := app.Permission.FindAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	var unheld []string
+	for _, code := range codes {
+		if !perms.Include(code) {
+			unheld = append(unheld, code)
+		}
+	}
+	return unheld, nil
+}
+
+// checkRolePermissions responds with a validation failure if the actor doesn't hold
+// all of the codes being added to a role, and reports whether the request may go on.
+func checkRolePermissions(c *gin.Context, app app.Application, codes []string) bool {
+	unheld, err := unheldPermissions(app, ContextGetUser(c).ID, codes)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return false
+	}
+	if len(unheld) > 0 {
+		v := validator.New()
+		v.AddError("permissions", fmt.Sprintf("must only contain permissions you hold (not held: %s)", strings.Join(unheld, ", ")))
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return false
+	}
+	return true
+}
+
+func ListRolesHandler(c *gin.Context, app app.Application) {
+	roles, err := app.Role.FindAll()
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func CreateRoleHandler(c *gin.Context, app app.Application) {
+	var input struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	r := &models.Role{
+		Name:        input.Name,
+		Description: input.Description,
+		Permissions: input.Permissions,
+	}
+
+	if !checkRolePermissions(c, app, r.Permissions) {
+		return
+	}
+
+	v, err := app.Role.Add(r)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		roleWriteError(c, app, err)
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/v1/roles/%d", r.ID))
+	c.JSON(http.StatusCreated, gin.H{"role": r})
+}
+
+func ShowRoleHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	role, err := app.Role.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role": role})
+}
+
+func UpdateRoleHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+	role, err := app.Role.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	var input struct {
+		Name        *string  `json:"name"`
+		Description *string  `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	if input.Name != nil {
+		role.Name = *input.Name
+	}
+	if input.Description != nil {
+		role.Description = *input.Description
+	}
+	// A provided permissions list replaces the existing one entirely. Only the codes
+	// it adds need to be held by the actor, so that a role which already bundles
+	// more than the actor holds can still be renamed or have codes removed.
+	if input.Permissions != nil {
+		var added []string
+		for _, code := range input.Permissions {
+			if !role.Permissions.Include(code) {
+				added = append(added, code)
+			}
+		}
+		if !checkRolePermissions(c, app, added) {
+			return
+		}
+		role.Permissions = input.Permissions
+	}
+
+	v, err := app.Role.Edit(ContextGetUser(c).ID, role)
+	if v != nil {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		roleWriteError(c, app, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"role": role})
+}
+
+func DeleteRoleHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	err = app.Role.RemoveByID(ContextGetUser(c).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role successfully deleted"})
+}
+
+func AssignRoleHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.UserID > 0, "user_id", "must be a positive integer"); !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	role, err := app.Role.FindByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+	actor := ContextGetUser(c)
+	unheld, err := unheldPermissions(app, actor.ID, role.Permissions)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+	if len(unheld) > 0 {
+		ErrorResponse(c, app, NotPermitted())
+		return
+	}
+
+	err = app.Role.AddForUser(actor.ID, id, input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role successfully assigned"})
+}
+
+func UnassignRoleHandler(c *gin.Context, app app.Application) {
+	id, err := ReadIDParam(c)
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+	userID, err := ReadNamedIDParam(c, "user_id")
+	if err != nil {
+		ErrorResponse(c, app, NotFoundError(err))
+		return
+	}
+
+	err = app.Role.RemoveForUser(ContextGetUser(c).ID, id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			ErrorResponse(c, app, NotFoundError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role successfully unassigned"})
+}
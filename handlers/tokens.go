@@ -67,3 +67,95 @@ func AuthenticationTokenHandler(c *gin.Context, app app.Application) {
 
 	c.JSON(http.StatusCreated, gin.H{"token": token})
 }
+
+func PasswordResetTokenHandler(c *gin.Context, app app.Application) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	v := validator.New()
+	if services.ValidateEmail(v, input.Email); !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	user, err := app.User.FindByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			v.AddError("email", "no matching email address found")
+			ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	// Only activated accounts can reset their password, otherwise a reset email
+	// could be used as a way around activating the account.
+	if !user.Activated {
+		v.AddError("email", "user account must be activated")
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	token, err := models.GenerateToken(user.ID, 45*time.Minute, models.ScopePasswordReset)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	v, err = app.Token.Add(token)
+	if !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	app.Background(func() {
+		data := map[string]any{
+			"passwordResetToken": token.Plaintext,
+		}
+		err = app.SMTP.Send(user.Email, "token_password_reset.tmpl", data)
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "an email will be sent to you containing password reset instructions"})
+}
+
+// RevokeAuthenticationTokenHandler deletes the bearer token that was used to make the
+// request. Because Authenticate looks every token up in the tokens table, the token is
+// rejected from the very next request onwards.
+func RevokeAuthenticationTokenHandler(c *gin.Context, app app.Application) {
+	err := app.Token.Remove(models.ScopeAuthentication, ContextGetToken(c))
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "authentication token successfully revoked"})
+}
+
+// RevokeAllAuthenticationTokensHandler signs the current user out everywhere by
+// deleting every authentication token that belongs to them.
+func RevokeAllAuthenticationTokensHandler(c *gin.Context, app app.Application) {
+	user := ContextGetUser(c)
+
+	err := app.Token.RemoveAllForUser(models.ScopeAuthentication, user.ID)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "all authentication tokens successfully revoked"})
+}
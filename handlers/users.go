@@ -9,6 +9,7 @@ import (
 	"github.com/rwx-yxu/greenlight/app"
 	"github.com/rwx-yxu/greenlight/internal/brokers"
 	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/services"
 	"github.com/rwx-yxu/greenlight/internal/validator"
 )
 
@@ -120,6 +121,15 @@ func ActivateUserHandler(c *gin.Context, app app.Application) {
 		}
 		return
 	}
+	// Every activated user has a watchlist. It is created before the user is
+	// activated, so that activation can be retried if it fails, and creating it
+	// again is harmless.
+	err = app.List.AddWatchlist(user.ID)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
 	user.Activated = true
 	//Update user. Do not need validator return value because the user model has already been
 	//validated when finding the token
@@ -138,3 +148,70 @@ func ActivateUserHandler(c *gin.Context, app app.Application) {
 
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
+
+func UpdateUserPasswordHandler(c *gin.Context, app app.Application) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	if err := ReadJSON(c, &input); err != nil {
+		ErrorResponse(c, app, StatusBadRequestError(err))
+		return
+	}
+
+	v := validator.New()
+	services.ValidatePasswordPlaintext(v, input.Password)
+	if app.Token.ValidatePlainText(v, input.TokenPlaintext); !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+
+	user, err := app.User.FindByToken(models.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		ErrorResponse(c, app, InternalServerError(err))
+		return
+	}
+
+	// Edit() bumps the user version, so a concurrent change to the same user is
+	// reported as an edit conflict rather than silently overwritten.
+	v, err = app.User.Edit(user)
+	if !v.Valid() {
+		ErrorResponse(c, app, FailedValidationResponse(v.Errors))
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, brokers.ErrEditConflict):
+			ErrorResponse(c, app, EditConflictError(err))
+		default:
+			ErrorResponse(c, app, InternalServerError(err))
+		}
+		return
+	}
+
+	// Delete every password reset token so that the one just used cannot be replayed,
+	// and every authentication token so that anyone holding the old password is
+	// signed out.
+	for _, scope := range []string{models.ScopePasswordReset, models.ScopeAuthentication} {
+		err = app.Token.RemoveAllForUser(scope, user.ID)
+		if err != nil {
+			ErrorResponse(c, app, InternalServerError(err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "your password was successfully reset"})
+}
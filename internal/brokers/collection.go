@@ -0,0 +1,431 @@
+package brokers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rwx-yxu/greenlight/internal/filter"
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+var (
+	ErrDuplicateCollectionName = errors.New("duplicate collection name")
+	ErrMovieInCollection       = errors.New("movie already in a collection")
+	ErrInvalidCollectionOrder  = errors.New("invalid collection order")
+)
+
+type collection struct {
+	db *sql.DB
+}
+
+type CollectionReader interface {
+	GetByID(id int64) (*models.Collection, error)
+	GetAll(f filter.Filter) ([]*models.Collection, filter.Metadata, error)
+	GetForMovie(movieID int64) (*models.MovieCollection, error)
+}
+
+type CollectionWriter interface {
+	Insert(c *models.Collection) error
+	Update(c *models.Collection) error
+	InsertMovie(collectionID, movieID int64) error
+	ReorderMovies(collectionID int64, movieIDs []int64) error
+}
+
+type CollectionDeleter interface {
+	DeleteByID(id int64) error
+	DeleteMovie(collectionID, movieID int64) error
+}
+
+type CollectionReadWriteDeleter interface {
+	CollectionReader
+	CollectionWriter
+	CollectionDeleter
+}
+
+func NewCollection(db *sql.DB) CollectionReadWriteDeleter {
+	return &collection{db: db}
+}
+
+// Movies in the trash are left in their collections, so that restoring them puts them
+// back, but they aren't counted or listed.
+const collectionColumns = `id, created_at, name, description, ordering,
+            (SELECT count(*) FROM collection_movies INNER JOIN movies ON movies.id = collection_movies.movie_id
+             WHERE collection_movies.collection_id = collections.id AND movies.deleted_at IS NULL), version`
+
+func collectionScanArgs(c *models.Collection) []any {
+	return []any{
+		&c.ID,
+		&c.CreatedAt,
+		&c.Name,
+		&c.Description,
+		&c.Ordering,
+		&c.MovieCount,
+		&c.Version,
+	}
+}
+
+func (cb collection) GetByID(id int64) (*models.Collection, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT ` + collectionColumns + `
+        FROM collections
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	c := new(models.Collection)
+	err := cb.db.QueryRowContext(ctx, query, id).Scan(collectionScanArgs(c)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	c.Movies, err = cb.entries(ctx, c.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// entries returns the movies in a collection in the collection's order. A collection
+// ordered by release sorts by year, and uses the custom order for movies released in
+// the same year.
+func (cb collection) entries(ctx context.Context, collectionID int64) ([]*models.CollectionEntry, error) {
+	query := `
+        SELECT movies.id, movies.title, movies.year
+        FROM collection_movies
+        INNER JOIN collections ON collections.id = collection_movies.collection_id
+        INNER JOIN movies ON movies.id = collection_movies.movie_id
+        WHERE collection_movies.collection_id = $1 AND movies.deleted_at IS NULL
+        ORDER BY CASE WHEN collections.ordering = 'release' THEN movies.year END,
+            collection_movies.position, movies.id`
+
+	rows, err := cb.db.QueryContext(ctx, query, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*models.CollectionEntry{}
+	for rows.Next() {
+		entry := &models.CollectionEntry{Position: len(entries) + 1}
+		err := rows.Scan(&entry.MovieID, &entry.Title, &entry.Year)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (cb collection) GetAll(f filter.Filter) ([]*models.Collection, filter.Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM collections
+        ORDER BY %s %s, id ASC
+        LIMIT $1 OFFSET $2`, collectionColumns, f.SortColumn(), f.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := cb.db.QueryContext(ctx, query, f.Limit(), f.Offset())
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	collections := []*models.Collection{}
+	for rows.Next() {
+		var c models.Collection
+		err := rows.Scan(append([]any{&totalRecords}, collectionScanArgs(&c)...)...)
+		if err != nil {
+			return nil, filter.Metadata{}, err
+		}
+		collections = append(collections, &c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, filter.Metadata{}, err
+	}
+
+	return collections, filter.CalculateMetadata(totalRecords, f.Page, f.PageSize), nil
+}
+
+// GetForMovie returns the collection block for a movie, or ErrRecordNotFound if the
+// movie isn't in a collection.
+func (cb collection) GetForMovie(movieID int64) (*models.MovieCollection, error) {
+	query := `
+        SELECT collections.id, collections.name
+        FROM collection_movies
+        INNER JOIN collections ON collections.id = collection_movies.collection_id
+        WHERE collection_movies.movie_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var mc models.MovieCollection
+	err := cb.db.QueryRowContext(ctx, query, movieID).Scan(&mc.ID, &mc.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	entries, err := cb.entries(ctx, mc.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	mc.Total = len(entries)
+	for i, entry := range entries {
+		if entry.MovieID != movieID {
+			continue
+		}
+		mc.Position = entry.Position
+		if i > 0 {
+			mc.Previous = entries[i-1]
+		}
+		if i < len(entries)-1 {
+			mc.Next = entries[i+1]
+		}
+	}
+
+	return &mc, nil
+}
+
+func (cb collection) Insert(c *models.Collection) error {
+	query := `
+        INSERT INTO collections (name, description, ordering)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := cb.db.QueryRowContext(ctx, query, c.Name, c.Description, c.Ordering).Scan(&c.ID, &c.CreatedAt, &c.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "collections_name_key"`:
+			return ErrDuplicateCollectionName
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cb collection) Update(c *models.Collection) error {
+	query := `
+        UPDATE collections
+        SET name = $1, description = $2, ordering = $3, version = version + 1
+        WHERE id = $4 AND version = $5
+        RETURNING version`
+
+	args := []any{c.Name, c.Description, c.Ordering, c.ID, c.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := cb.db.QueryRowContext(ctx, query, args...).Scan(&c.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "collections_name_key"`:
+			return ErrDuplicateCollectionName
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteByID deletes a collection. Its movies are left alone, and are free to join
+// another collection.
+func (cb collection) DeleteByID(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM collections
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := cb.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// InsertMovie adds a movie to the end of a collection's custom order. It returns
+// ErrRecordNotFound if the collection or movie doesn't exist or the movie is in the
+// trash, and ErrMovieInCollection if the movie already belongs to a collection.
+func (cb collection) InsertMovie(collectionID, movieID int64) error {
+	query := `
+        INSERT INTO collection_movies (collection_id, movie_id, position)
+        SELECT $1, movies.id, COALESCE((SELECT max(position) FROM collection_movies WHERE collection_id = $1), 0) + 1
+        FROM movies
+        WHERE movies.id = $2 AND movies.deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := cb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the collection so that two movies added at the same time don't get the
+	// same position.
+	err = lockCollection(ctx, tx, collectionID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, query, collectionID, movieID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "collection_movies_pkey"`:
+			return ErrMovieInCollection
+		default:
+			return err
+		}
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (cb collection) DeleteMovie(collectionID, movieID int64) error {
+	query := `
+        DELETE FROM collection_movies
+        WHERE collection_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := cb.db.ExecContext(ctx, query, collectionID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ReorderMovies sets a collection's custom order, given as the ids of every movie in
+// it outside the trash. It returns ErrInvalidCollectionOrder if any are missing or
+// some other movie is named.
+func (cb collection) ReorderMovies(collectionID int64, movieIDs []int64) error {
+	query := `
+        UPDATE collection_movies
+        SET position = ordered.position
+        FROM unnest($2::bigint[]) WITH ORDINALITY AS ordered(movie_id, position)
+        WHERE collection_movies.collection_id = $1 AND collection_movies.movie_id = ordered.movie_id
+        AND collection_movies.movie_id IN (SELECT id FROM movies WHERE deleted_at IS NULL)`
+
+	countQuery := `
+        SELECT count(*)
+        FROM collection_movies
+        INNER JOIN movies ON movies.id = collection_movies.movie_id
+        WHERE collection_movies.collection_id = $1 AND movies.deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := cb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockCollection(ctx, tx, collectionID)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, countQuery, collectionID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, query, collectionID, pq.Array(movieIDs))
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if int(rowsAffected) != count || len(movieIDs) != count {
+		return ErrInvalidCollectionOrder
+	}
+
+	return tx.Commit()
+}
+
+func lockCollection(ctx context.Context, tx *sql.Tx, collectionID int64) error {
+	query := `SELECT id FROM collections WHERE id = $1 FOR UPDATE`
+
+	err := tx.QueryRowContext(ctx, query, collectionID).Scan(&collectionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
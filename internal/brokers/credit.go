@@ -0,0 +1,167 @@
+package brokers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+var (
+	ErrUnknownPerson   = errors.New("unknown person")
+	ErrDuplicateCredit = errors.New("duplicate credit")
+)
+
+type credit struct {
+	db *sql.DB
+}
+
+type CreditReader interface {
+	GetAllForMovie(movieID int64) ([]*models.Credit, error)
+	GetAllForPerson(personID int64) ([]*models.Credit, error)
+}
+
+type CreditWriter interface {
+	Insert(c *models.Credit) error
+}
+
+type CreditDeleter interface {
+	Delete(movieID, id int64) error
+}
+
+type CreditReadWriteDeleter interface {
+	CreditReader
+	CreditWriter
+	CreditDeleter
+}
+
+func NewCredit(db *sql.DB) CreditReadWriteDeleter {
+	return &credit{db: db}
+}
+
+// creditRoleOrder sorts credits with directors first, then writers, then actors.
+const creditRoleOrder = `CASE movie_credits.role WHEN 'director' THEN 1 WHEN 'writer' THEN 2 ELSE 3 END`
+
+// GetAllForMovie retrieves a movie's credits, each with the person's name, in billing
+// order within each role.
+func (cr credit) GetAllForMovie(movieID int64) ([]*models.Credit, error) {
+	query := `
+        SELECT movie_credits.id, movie_credits.movie_id, movie_credits.person_id,
+            movie_credits.role, movie_credits.character, movie_credits.billing, people.name
+        FROM movie_credits
+        INNER JOIN people ON people.id = movie_credits.person_id
+        WHERE movie_credits.movie_id = $1
+        ORDER BY ` + creditRoleOrder + `, movie_credits.billing = 0, movie_credits.billing, movie_credits.id`
+
+	return cr.list(query, movieID, func(c *models.Credit) []any {
+		return []any{&c.PersonName}
+	})
+}
+
+// GetAllForPerson retrieves a person's filmography, newest movies first, each credit
+// with the movie's title and year. Movies in the trash are left out.
+func (cr credit) GetAllForPerson(personID int64) ([]*models.Credit, error) {
+	query := `
+        SELECT movie_credits.id, movie_credits.movie_id, movie_credits.person_id,
+            movie_credits.role, movie_credits.character, movie_credits.billing, movies.title, movies.year
+        FROM movie_credits
+        INNER JOIN movies ON movies.id = movie_credits.movie_id
+        WHERE movie_credits.person_id = $1 AND movies.deleted_at IS NULL
+        ORDER BY movies.year DESC, movies.id, ` + creditRoleOrder + `, movie_credits.id`
+
+	return cr.list(query, personID, func(c *models.Credit) []any {
+		return []any{&c.MovieTitle, &c.MovieYear}
+	})
+}
+
+// list runs a credit query which selects the columns of movie_credits followed by the
+// extra columns that are scanned into the destinations returned by extra.
+func (cr credit) list(query string, id int64, extra func(*models.Credit) []any) ([]*models.Credit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := cr.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*models.Credit{}
+
+	for rows.Next() {
+		var c models.Credit
+
+		dest := []any{&c.ID, &c.MovieID, &c.PersonID, &c.Role, &c.Character, &c.Billing}
+		err := rows.Scan(append(dest, extra(&c)...)...)
+		if err != nil {
+			return nil, err
+		}
+
+		credits = append(credits, &c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// Insert adds a credit to a movie. It returns ErrRecordNotFound if the movie doesn't
+// exist or is in the trash, ErrUnknownPerson if the person doesn't exist and
+// ErrDuplicateCredit if the movie already has the same credit.
+func (cr credit) Insert(c *models.Credit) error {
+	query := `
+        INSERT INTO movie_credits (movie_id, person_id, role, character, billing)
+        SELECT movies.id, $2, $3, $4, $5
+        FROM movies
+        WHERE movies.id = $1 AND movies.deleted_at IS NULL
+        RETURNING id`
+
+	args := []any{c.MovieID, c.PersonID, c.Role, c.Character, c.Billing}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := cr.db.QueryRowContext(ctx, query, args...).Scan(&c.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		case err.Error() == `pq: insert or update on table "movie_credits" violates foreign key constraint "movie_credits_person_id_fkey"`:
+			return ErrUnknownPerson
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_credits_movie_id_person_id_role_character_key"`:
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a credit from a movie.
+func (cr credit) Delete(movieID, id int64) error {
+	query := `
+        DELETE FROM movie_credits
+        WHERE id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := cr.db.ExecContext(ctx, query, id, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
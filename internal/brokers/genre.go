@@ -0,0 +1,342 @@
+package brokers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+var ErrDuplicateGenre = errors.New("duplicate genre")
+
+type genre struct {
+	db *sql.DB
+}
+
+type GenreReader interface {
+	GetAll() ([]*models.Genre, error)
+	GetLookup() (map[string]string, error)
+}
+
+type GenreWriter interface {
+	Insert(g *models.Genre) error
+	Merge(actorID int64, sources []string, target string) (int64, error)
+}
+
+type GenreReadWriter interface {
+	GenreReader
+	GenreWriter
+}
+
+func NewGenre(db *sql.DB) GenreReadWriter {
+	return &genre{db: db}
+}
+
+// GetAll returns every genre in slug order, along with the number of movies outside
+// the trash which have it.
+func (g genre) GetAll() ([]*models.Genre, error) {
+	query := `
+        SELECT genres.id, genres.created_at, genres.slug, genres.name,
+            ARRAY(SELECT alias FROM genre_aliases
+                  WHERE genre_id = genres.id AND alias <> genres.slug
+                  ORDER BY alias),
+            (SELECT count(*) FROM movies
+             WHERE genres @> ARRAY[genres.slug] AND deleted_at IS NULL)
+        FROM genres
+        ORDER BY genres.slug`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := g.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*models.Genre{}
+	for rows.Next() {
+		var genre models.Genre
+		err := rows.Scan(
+			&genre.ID,
+			&genre.CreatedAt,
+			&genre.Slug,
+			&genre.Name,
+			pq.Array(&genre.Aliases),
+			&genre.Movies,
+		)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// GetLookup returns a map from every alias, including each genre's own slug, to the
+// slug of the genre it names. The taxonomy is small, so it is read in one go.
+func (g genre) GetLookup() (map[string]string, error) {
+	query := `
+        SELECT genre_aliases.alias, genres.slug
+        FROM genre_aliases
+        INNER JOIN genres ON genres.id = genre_aliases.genre_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := g.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lookup := map[string]string{}
+	for rows.Next() {
+		var alias, slug string
+		if err := rows.Scan(&alias, &slug); err != nil {
+			return nil, err
+		}
+		lookup[alias] = slug
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lookup, nil
+}
+
+// Insert adds a genre and its aliases. It returns ErrDuplicateGenre if the slug or any
+// of the aliases already names a genre.
+func (g genre) Insert(genre *models.Genre) error {
+	query := `
+        INSERT INTO genres (slug, name)
+        VALUES ($1, $2)
+        RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := g.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, genre.Slug, genre.Name).Scan(&genre.ID, &genre.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"`:
+			return ErrDuplicateGenre
+		default:
+			return err
+		}
+	}
+
+	query = `
+        INSERT INTO genre_aliases (alias, genre_id)
+        SELECT unnest($1::text[]), $2`
+
+	aliases := append([]string{genre.Slug}, genre.Aliases...)
+	_, err = tx.ExecContext(ctx, query, pq.Array(aliases), genre.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genre_aliases_pkey"`:
+			return ErrDuplicateGenre
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Merge folds the source genres into the target. Movies with a source genre have it
+// replaced by the target, without duplicating the target if they already have it, and
+// the sources' slugs and aliases become aliases of the target so that the old names
+// keep working. It returns the number of movies changed, including those in the trash,
+// or ErrRecordNotFound if any of the genres don't exist.
+//
+// Each changed movie has its version bumped and an update revision recorded on behalf
+// of the actor, so that its history stays complete and rolling it back to an earlier
+// version doesn't bring back a genre that no longer exists unnoticed.
+func (g genre) Merge(actorID int64, sources []string, target string) (int64, error) {
+	// Merging a widely used genre rewrites a lot of movies, so this is given longer
+	// than the usual timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := g.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var targetID int64
+	err = tx.QueryRowContext(ctx, `SELECT id FROM genres WHERE slug = $1 FOR UPDATE`, target).Scan(&targetID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	var sourceIDs []int64
+	query := `
+        SELECT array_agg(id)
+        FROM (SELECT id FROM genres WHERE slug = ANY($1) FOR UPDATE) AS locked`
+	err = tx.QueryRowContext(ctx, query, pq.Array(sources)).Scan(pq.Array(&sourceIDs))
+	if err != nil {
+		return 0, err
+	}
+	if len(sourceIDs) != len(sources) {
+		return 0, ErrRecordNotFound
+	}
+
+	before, err := lockGenreMovies(ctx, tx, sources)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `
+        UPDATE movies
+        SET genres = ARRAY(
+                SELECT genre
+                FROM (SELECT CASE WHEN u.genre = ANY($1) THEN $2 ELSE u.genre END AS genre, min(u.n) AS n
+                      FROM unnest(movies.genres) WITH ORDINALITY AS u(genre, n)
+                      GROUP BY 1) AS merged
+                ORDER BY n),
+            version = version + 1
+        WHERE genres && $1
+        RETURNING id, genres, version`
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(sources), target)
+	if err != nil {
+		return 0, err
+	}
+	var after []*models.Movie
+	for rows.Next() {
+		var id int64
+		var genres []string
+		var version int32
+		if err := rows.Scan(&id, pq.Array(&genres), &version); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		movie := *before[id]
+		movie.Genres, movie.Version = genres, version
+		after = append(after, &movie)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, movie := range after {
+		err = insertMovieRevision(ctx, tx, actorID, movie.ID, movie.Version, models.MovieUpdate, before[movie.ID], movie)
+		if err != nil {
+			return 0, err
+		}
+	}
+	rowsAffected := int64(len(after))
+
+	query = `
+        UPDATE genre_aliases
+        SET genre_id = $1
+        WHERE genre_id = ANY($2)`
+
+	_, err = tx.ExecContext(ctx, query, targetID, pq.Array(sourceIDs))
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM genres WHERE id = ANY($1)`, pq.Array(sourceIDs))
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected, tx.Commit()
+}
+
+// lockGenreMovies locks every movie with any of the given genres, including those in
+// the trash, and returns them keyed by id as they are before a merge changes them.
+func lockGenreMovies(ctx context.Context, tx *sql.Tx, genres []string) (map[int64]*models.Movie, error) {
+	query := `
+        SELECT id, created_at, title, year, runtime, genres, version, rating, votes, deleted_at
+        FROM movies
+        WHERE genres && $1
+        ORDER BY id
+        FOR UPDATE`
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(genres))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := map[int64]*models.Movie{}
+	var ids []int64
+	for rows.Next() {
+		var movie models.Movie
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.Votes,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movies[movie.ID] = &movie
+		ids = append(ids, movie.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Read the external ids of all the movies at once, as they are part of the state
+	// each revision records.
+	query = `
+        SELECT movie_id, source, external_id
+        FROM movie_external_ids
+        WHERE movie_id = ANY($1)`
+
+	rows, err = tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var source, externalID string
+		if err := rows.Scan(&id, &source, &externalID); err != nil {
+			return nil, err
+		}
+		movie := movies[id]
+		if movie.ExternalIDs == nil {
+			movie.ExternalIDs = map[string]string{}
+		}
+		movie.ExternalIDs[source] = externalID
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
@@ -0,0 +1,208 @@
+package brokers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+type image struct {
+	db *sql.DB
+}
+
+type ImageReader interface {
+	GetByToken(token string) (*models.Image, error)
+	GetAllForMovie(movieID int64) ([]*models.Image, error)
+}
+
+type ImageWriter interface {
+	Replace(img *models.Image, store func(id int64) error) (int64, error)
+}
+
+type ImageDeleter interface {
+	Delete(movieID int64, kind string) (int64, error)
+}
+
+type ImageReadWriteDeleter interface {
+	ImageReader
+	ImageWriter
+	ImageDeleter
+}
+
+func NewImage(db *sql.DB) ImageReadWriteDeleter {
+	return &image{db: db}
+}
+
+// GetByToken returns the image with the given token, unless its movie is in the trash.
+func (i image) GetByToken(token string) (*models.Image, error) {
+	if token == "" {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT movie_images.id, movie_images.token, movie_images.created_at, movie_images.movie_id,
+            movie_images.kind, movie_images.content_type, movie_images.width, movie_images.height
+        FROM movie_images
+        INNER JOIN movies ON movies.id = movie_images.movie_id
+        WHERE movie_images.token = $1 AND movies.deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var img models.Image
+	err := i.db.QueryRowContext(ctx, query, token).Scan(
+		&img.ID,
+		&img.Token,
+		&img.CreatedAt,
+		&img.MovieID,
+		&img.Kind,
+		&img.ContentType,
+		&img.Width,
+		&img.Height,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &img, nil
+}
+
+// GetAllForMovie returns the images of a movie, including one in the trash, so that
+// they can be cleaned up when it is purged.
+func (i image) GetAllForMovie(movieID int64) ([]*models.Image, error) {
+	query := `
+        SELECT id, token, created_at, movie_id, kind, content_type, width, height
+        FROM movie_images
+        WHERE movie_id = $1
+        ORDER BY kind`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := i.db.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*models.Image{}
+	for rows.Next() {
+		var img models.Image
+		err := rows.Scan(
+			&img.ID,
+			&img.Token,
+			&img.CreatedAt,
+			&img.MovieID,
+			&img.Kind,
+			&img.ContentType,
+			&img.Width,
+			&img.Height,
+		)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, &img)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// Replace adds an image to a movie in place of any existing image of the same kind,
+// and returns the ID of the image it replaced, or 0 if there wasn't one. The new row
+// is only committed if store, which is passed the new image's ID, succeeds in saving
+// its files. It returns ErrRecordNotFound if the movie doesn't exist or is in the
+// trash.
+func (i image) Replace(img *models.Image, store func(id int64) error) (int64, error) {
+	// This is given longer than the usual timeout as store runs inside it.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// A share lock is enough to stop the movie being purged, without holding up
+	// edits to it.
+	query := `
+        SELECT id FROM movies
+        WHERE id = $1 AND deleted_at IS NULL
+        FOR KEY SHARE`
+
+	var movieID int64
+	err = tx.QueryRowContext(ctx, query, img.MovieID).Scan(&movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	query = `
+        DELETE FROM movie_images
+        WHERE movie_id = $1 AND kind = $2
+        RETURNING id`
+
+	var oldID int64
+	err = tx.QueryRowContext(ctx, query, img.MovieID, img.Kind).Scan(&oldID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	query = `
+        INSERT INTO movie_images (movie_id, kind, content_type, width, height)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, token, created_at`
+
+	args := []any{img.MovieID, img.Kind, img.ContentType, img.Width, img.Height}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&img.ID, &img.Token, &img.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	err = store(img.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return oldID, tx.Commit()
+}
+
+// Delete removes a movie's image of the given kind and returns its ID, or
+// ErrRecordNotFound if the movie doesn't have one.
+func (i image) Delete(movieID int64, kind string) (int64, error) {
+	query := `
+        DELETE FROM movie_images
+        WHERE movie_id = $1 AND kind = $2
+        RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := i.db.QueryRowContext(ctx, query, movieID, kind).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
@@ -0,0 +1,422 @@
+package brokers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+var (
+	ErrDuplicateListName = errors.New("duplicate list name")
+	ErrDuplicateListItem = errors.New("duplicate list item")
+	ErrInvalidListOrder  = errors.New("invalid list order")
+)
+
+type list struct {
+	db *sql.DB
+}
+
+type ListReader interface {
+	GetByID(id int64) (*models.List, error)
+	GetBySlug(slug string) (*models.List, error)
+	GetAllForUser(userID int64) ([]*models.List, error)
+}
+
+type ListWriter interface {
+	Insert(list *models.List) error
+	InsertWatchlist(userID int64) error
+	Update(list *models.List) error
+	InsertItem(listID, movieID int64) (*models.ListItem, error)
+	ReorderItems(listID int64, movieIDs []int64) error
+}
+
+type ListDeleter interface {
+	DeleteByID(id int64) error
+	DeleteItem(listID, movieID int64) error
+}
+
+type ListReadWriteDeleter interface {
+	ListReader
+	ListWriter
+	ListDeleter
+}
+
+func NewList(db *sql.DB) ListReadWriteDeleter {
+	return &list{db: db}
+}
+
+const listColumns = `id, created_at, user_id, name, watchlist, public, COALESCE(slug, ''),
+            (SELECT count(*) FROM list_items INNER JOIN movies ON movies.id = list_items.movie_id
+             WHERE list_items.list_id = lists.id AND movies.deleted_at IS NULL), version`
+
+func listScanArgs(l *models.List) []any {
+	return []any{
+		&l.ID,
+		&l.CreatedAt,
+		&l.UserID,
+		&l.Name,
+		&l.Watchlist,
+		&l.Public,
+		&l.Slug,
+		&l.ItemCount,
+		&l.Version,
+	}
+}
+
+func (l list) GetByID(id int64) (*models.List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT ` + listColumns + `
+        FROM lists
+        WHERE id = $1`
+
+	return l.get(query, id)
+}
+
+// GetBySlug retrieves a list that has been shared. Lists which aren't public aren't
+// found, even if they had a slug when they were shared in the past.
+func (l list) GetBySlug(slug string) (*models.List, error) {
+	query := `
+        SELECT ` + listColumns + `
+        FROM lists
+        WHERE slug = $1 AND public`
+
+	return l.get(query, slug)
+}
+
+// get retrieves a single list along with its items, in order. Movies in the trash are
+// left out.
+func (l list) get(query string, arg any) (*models.List, error) {
+	itemsQuery := `
+        SELECT list_items.position, list_items.added_at,
+            movies.id, movies.title, movies.year, movies.runtime, movies.genres,
+            movies.version, movies.rating, movies.votes
+        FROM list_items
+        INNER JOIN movies ON movies.id = list_items.movie_id
+        WHERE list_items.list_id = $1 AND movies.deleted_at IS NULL
+        ORDER BY list_items.position`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	list := new(models.List)
+	err := l.db.QueryRowContext(ctx, query, arg).Scan(listScanArgs(list)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	rows, err := l.db.QueryContext(ctx, itemsQuery, list.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list.Items = []*models.ListItem{}
+
+	for rows.Next() {
+		item := models.ListItem{Movie: new(models.Movie)}
+
+		err := rows.Scan(
+			&item.Position,
+			&item.AddedAt,
+			&item.Movie.ID,
+			&item.Movie.Title,
+			&item.Movie.Year,
+			&item.Movie.Runtime,
+			pq.Array(&item.Movie.Genres),
+			&item.Movie.Version,
+			&item.Movie.Rating,
+			&item.Movie.Votes,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		list.Items = append(list.Items, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// GetAllForUser retrieves every list belonging to a user, watchlist first, without
+// their items.
+func (l list) GetAllForUser(userID int64) ([]*models.List, error) {
+	query := `
+        SELECT ` + listColumns + `
+        FROM lists
+        WHERE user_id = $1
+        ORDER BY watchlist DESC, name ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := l.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*models.List{}
+
+	for rows.Next() {
+		var list models.List
+
+		err := rows.Scan(listScanArgs(&list)...)
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// InsertWatchlist creates a user's watchlist. Creating it for a user who already has
+// one is not an error.
+func (l list) InsertWatchlist(userID int64) error {
+	query := `
+        INSERT INTO lists (user_id, name, watchlist)
+        VALUES ($1, $2, true)
+        ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, query, userID, models.WatchlistName)
+	return err
+}
+
+func (l list) Insert(list *models.List) error {
+	query := `
+        INSERT INTO lists (user_id, name, public, slug)
+        VALUES ($1, $2, $3, NULLIF($4, ''))
+        RETURNING id, created_at, version`
+
+	args := []any{list.UserID, list.Name, list.Public, list.Slug}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := l.db.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "lists_user_id_name_key"`:
+			return ErrDuplicateListName
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l list) Update(list *models.List) error {
+	query := `
+        UPDATE lists
+        SET name = $1, public = $2, slug = NULLIF($3, ''), version = version + 1
+        WHERE id = $4 AND version = $5
+        RETURNING version`
+
+	args := []any{list.Name, list.Public, list.Slug, list.ID, list.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := l.db.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "lists_user_id_name_key"`:
+			return ErrDuplicateListName
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l list) DeleteByID(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM lists
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := l.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// InsertItem adds a movie to the end of a list. It returns ErrRecordNotFound if the
+// movie doesn't exist or is in the trash, and ErrDuplicateListItem if it is already on
+// the list.
+func (l list) InsertItem(listID, movieID int64) (*models.ListItem, error) {
+	query := `
+        INSERT INTO list_items (list_id, movie_id, position)
+        SELECT $1, movies.id, COALESCE((SELECT max(position) FROM list_items WHERE list_id = $1), 0) + 1
+        FROM movies
+        WHERE movies.id = $2 AND movies.deleted_at IS NULL
+        RETURNING position, added_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the list so that two movies added at the same time don't get the same
+	// position.
+	err = lockList(ctx, tx, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &models.ListItem{Movie: &models.Movie{ID: movieID}}
+	err = tx.QueryRowContext(ctx, query, listID, movieID).Scan(&item.Position, &item.AddedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		case err.Error() == `pq: duplicate key value violates unique constraint "list_items_pkey"`:
+			return nil, ErrDuplicateListItem
+		default:
+			return nil, err
+		}
+	}
+
+	return item, tx.Commit()
+}
+
+func (l list) DeleteItem(listID, movieID int64) error {
+	query := `
+        DELETE FROM list_items
+        WHERE list_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := l.db.ExecContext(ctx, query, listID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ReorderItems puts the movies on a list into the given order. movieIDs must contain
+// every movie on the list exactly once, otherwise ErrInvalidListOrder is returned and
+// the list is left as it was. Movies in the trash aren't shown on lists, so they
+// aren't expected in movieIDs and keep their old positions.
+func (l list) ReorderItems(listID int64, movieIDs []int64) error {
+	query := `
+        UPDATE list_items
+        SET position = ordered.position
+        FROM unnest($2::bigint[]) WITH ORDINALITY AS ordered(movie_id, position)
+        WHERE list_items.list_id = $1 AND list_items.movie_id = ordered.movie_id
+        AND list_items.movie_id IN (SELECT id FROM movies WHERE deleted_at IS NULL)`
+
+	countQuery := `
+        SELECT count(*)
+        FROM list_items
+        INNER JOIN movies ON movies.id = list_items.movie_id
+        WHERE list_items.list_id = $1 AND movies.deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockList(ctx, tx, listID)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, countQuery, listID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, query, listID, pq.Array(movieIDs))
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Every movie on the list has to have been moved, and nothing else named.
+	if int(rowsAffected) != count || len(movieIDs) != count {
+		return ErrInvalidListOrder
+	}
+
+	return tx.Commit()
+}
+
+func lockList(ctx context.Context, tx *sql.Tx, listID int64) error {
+	query := `SELECT id FROM lists WHERE id = $1 FOR UPDATE`
+
+	err := tx.QueryRowContext(ctx, query, listID).Scan(&listID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -3,8 +3,11 @@ package brokers
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/lib/pq"
@@ -18,16 +21,28 @@ type movie struct {
 
 type MovieReader interface {
 	GetByID(id int64) (*models.Movie, error)
-	GetAll(title string, genres []string, f filter.Filter) ([]*models.Movie, filter.Metadata, error)
+	GetByExternalID(source, externalID string) (*models.Movie, error)
+	GetUsedExternalIDs(ids []models.ExternalID) (map[models.ExternalID]bool, error)
+	GetAll(f filter.MovieFilter) ([]*models.Movie, filter.Metadata, error)
+	GetSuggestions(q string, threshold float64, limit int) ([]*models.MovieSuggestion, error)
+	GetAllDeleted(f filter.Filter) ([]*models.Movie, filter.Metadata, error)
+	GetRevisions(movieID int64, f filter.Filter) ([]*models.MovieRevision, filter.Metadata, error)
+	GetRevision(movieID int64, version int32) (*models.MovieRevision, error)
+	Export(ctx context.Context, f filter.MovieFilter, fn func(*models.Movie) error) error
 }
 
 type MovieWriter interface {
-	Update(m *models.Movie) error
-	Insert(movie *models.Movie) error
+	Update(actorID int64, m *models.Movie) error
+	Insert(actorID int64, movie *models.Movie) error
+	InsertBatch(actorID int64, movies []*models.Movie) error
+	UpsertBatch(actorID int64, source string, movies []*models.Movie) (created, updated int, err error)
+	Restore(actorID, id int64) (*models.Movie, error)
 }
 
 type MovieDeleter interface {
-	DeleteByID(id int64) error
+	DeleteByID(actorID, id int64) error
+	DeleteByIDAndVersion(actorID, id int64, version int32) error
+	Purge(id int64) error
 }
 
 type MovieReadWriteDeleter interface {
@@ -39,6 +54,8 @@ type MovieReadWriteDeleter interface {
 var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrEditConflict   = errors.New("edit conflict")
+
+	ErrDuplicateExternalID = errors.New("duplicate external id")
 )
 
 func NewMovie(db *sql.DB) MovieReadWriteDeleter {
@@ -56,9 +73,9 @@ func (m movie) GetByID(id int64) (*models.Movie, error) {
 
 	// Define the SQL query for retrieving the movie data.
 	query := `
-        SELECT id, created_at, title, year, runtime, genres, version
+        SELECT id, created_at, title, year, runtime, genres, version, rating, votes
         FROM movies
-        WHERE id = $1`
+        WHERE id = $1 AND deleted_at IS NULL`
 
 	// Declare a Movie struct to hold the data returned by the query.
 	movie := new(models.Movie)
@@ -83,6 +100,8 @@ func (m movie) GetByID(id int64) (*models.Movie, error) {
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
 		&movie.Version,
+		&movie.Rating,
+		&movie.Votes,
 	)
 
 	// Handle any errors. If there was no matching movie found, Scan() will return
@@ -97,18 +116,86 @@ func (m movie) GetByID(id int64) (*models.Movie, error) {
 		}
 	}
 
+	movie.ExternalIDs, err = movieExternalIDs(ctx, m.db, movie.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Otherwise, return a pointer to the Movie struct.
 	return movie, nil
 
 }
 
-func (m movie) Update(movie *models.Movie) error {
+// GetByExternalID returns the movie with an external id from the given source. A movie
+// in the trash keeps its external ids but isn't found.
+func (m movie) GetByExternalID(source, externalID string) (*models.Movie, error) {
+	query := `
+        SELECT movie_id
+        FROM movie_external_ids
+        WHERE source = $1 AND external_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.db.QueryRowContext(ctx, query, source, externalID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return m.GetByID(id)
+}
+
+// GetUsedExternalIDs returns which of the given external ids already belong to a
+// movie, including one in the trash.
+func (m movie) GetUsedExternalIDs(ids []models.ExternalID) (map[models.ExternalID]bool, error) {
+	query := `
+        SELECT source, external_id
+        FROM movie_external_ids
+        WHERE (source, external_id) IN (SELECT * FROM unnest($1::text[], $2::text[]))`
+
+	sources := make([]string, len(ids))
+	externalIDs := make([]string, len(ids))
+	for i, id := range ids {
+		sources[i], externalIDs[i] = id.Source, id.ID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, pq.Array(sources), pq.Array(externalIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	used := make(map[models.ExternalID]bool)
+	for rows.Next() {
+		var id models.ExternalID
+		if err := rows.Scan(&id.Source, &id.ID); err != nil {
+			return nil, err
+		}
+		used[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return used, nil
+}
+
+func (m movie) Update(actorID int64, movie *models.Movie) error {
 	// Declare the SQL query for updating the record and returning the new version
 	// number.
 	query := `
         UPDATE movies
         SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        WHERE id = $5 AND version = $6 AND deleted_at IS NULL
         RETURNING version`
 
 	// Create an args slice containing the values for the placeholder parameters.
@@ -122,10 +209,32 @@ func (m movie) Update(movie *models.Movie) error {
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the row and read its current state for the revision. If the movie has
+	// already moved on from the version the caller read, it is an edit conflict.
+	before, err := lockMovie(ctx, tx, movie.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	if before.Version != movie.Version {
+		return ErrEditConflict
+	}
+
 	// Execute the SQL query. If no matching row could be found, we know the movie
 	// version has changed (or the record has been deleted) and we return our custom
 	// ErrEditConflict error.
-	err := m.db.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -135,39 +244,161 @@ func (m movie) Update(movie *models.Movie) error {
 		}
 	}
 
-	return nil
+	err = setMovieExternalIDs(ctx, tx, movie)
+	if err != nil {
+		return err
+	}
+
+	err = insertMovieRevision(ctx, tx, actorID, movie.ID, movie.Version, models.MovieUpdate, before, movie)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m movie) DeleteByID(actorID, id int64) error {
+	return m.trash(actorID, id, 0)
+}
+
+// DeleteByIDAndVersion moves a movie to the trash only if it is still at the given
+// version, returning ErrEditConflict if it has been updated or deleted in the meantime.
+func (m movie) DeleteByIDAndVersion(actorID, id int64, version int32) error {
+	return m.trash(actorID, id, version)
 }
 
-func (m movie) DeleteByID(id int64) error {
+// trash moves a movie to the trash. If version isn't zero the movie must still be at
+// that version, otherwise ErrEditConflict is returned.
+func (m movie) trash(actorID, id int64, version int32) error {
 	// Return an ErrRecordNotFound error if the movie ID is less than 1.
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	// Construct the SQL query to delete the record.
+	// Construct the SQL query to move the record to the trash. The version is bumped
+	// so that any ETag a client holds for the movie no longer matches.
+	query := `
+        UPDATE movies
+        SET deleted_at = NOW(), version = version + 1
+        WHERE id = $1
+        RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockMovie(ctx, tx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound) && version != 0:
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	if version != 0 && before.Version != version {
+		return ErrEditConflict
+	}
+
+	var newVersion int32
+	err = tx.QueryRowContext(ctx, query, id).Scan(&newVersion)
+	if err != nil {
+		return err
+	}
+
+	err = insertMovieRevision(ctx, tx, actorID, id, newVersion, models.MovieDelete, before, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Restore takes a movie back out of the trash and returns it as it now is, or
+// ErrRecordNotFound if there is no trashed movie with that id.
+func (m movie) Restore(actorID, id int64) (*models.Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        UPDATE movies
+        SET deleted_at = NULL, version = version + 1
+        WHERE id = $1 AND deleted_at IS NOT NULL
+        RETURNING id, created_at, title, year, runtime, genres, version, rating, votes`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	movie := new(models.Movie)
+	err = tx.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.Rating,
+		&movie.Votes,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	movie.ExternalIDs, err = movieExternalIDs(ctx, tx, movie.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertMovieRevision(ctx, tx, actorID, movie.ID, movie.Version, models.MovieRestore, nil, movie)
+	if err != nil {
+		return nil, err
+	}
+
+	return movie, tx.Commit()
+}
+
+// Purge permanently deletes a movie from the trash, along with its revisions. Movies
+// that haven't been trashed can't be purged, so a movie always has to be deleted twice
+// before it is gone.
+func (m movie) Purge(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
 	query := `
         DELETE FROM movies
-        WHERE id = $1`
+        WHERE id = $1 AND deleted_at IS NOT NULL`
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	// Execute the SQL query using the Exec() method, passing in the id variable as
-	// the value for the placeholder parameter. The Exec() method returns a sql.Result
-	// object.
+
 	result, err := m.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
 
-	// Call the RowsAffected() method on the sql.Result object to get the number of rows
-	// affected by the query.
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-
-	// If no rows were affected, we know that the movies table didn't contain a record
-	// with the provided ID at the moment we tried to delete it. In that case we
-	// return an ErrRecordNotFound error.
 	if rowsAffected == 0 {
 		return ErrRecordNotFound
 	}
@@ -175,7 +406,7 @@ func (m movie) DeleteByID(id int64) error {
 	return nil
 }
 
-func (m movie) Insert(movie *models.Movie) error {
+func (m movie) Insert(actorID int64, movie *models.Movie) error {
 
 	// Define the SQL query for inserting a new record in the movies table and returning
 	// the system-generated data.
@@ -191,75 +422,906 @@ func (m movie) Insert(movie *models.Movie) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	// Use the QueryRow() method to execute the SQL query on our connection pool,
-	// passing in the args slice as a variadic parameter and scanning the system-
-	// generated id, created_at and version values into the movie struct.
-	return m.db.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
 
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Use the QueryRow() method to execute the SQL query, passing in the args slice as
+	// a variadic parameter and scanning the system-generated id, created_at and
+	// version values into the movie struct.
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+
+	err = setMovieExternalIDs(ctx, tx, movie)
+	if err != nil {
+		return err
+	}
+
+	err = insertMovieRevision(ctx, tx, actorID, movie.ID, movie.Version, models.MovieCreate, nil, movie)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m movie) GetAll(title string, genres []string, f filter.Filter) ([]*models.Movie, filter.Metadata, error) {
-	// Construct the SQL query to retrieve all movie records.
-	query := fmt.Sprintf(`
-        SELECT count(*) OVER(),id, created_at, title, year, runtime, genres, version
-        FROM movies
-        WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-        AND (genres @> $2 OR $2 = '{}')
-        ORDER BY %s %s, id ASC
-				LIMIT $3 OFFSET $4`, f.SortColumn(), f.SortDirection())
+// InsertBatch inserts several movies in a single transaction, so either all of them
+// are created or none are. Each movie gets its id, created_at and version set as with
+// Insert.
+func (m movie) InsertBatch(actorID int64, movies []*models.Movie) error {
+	query := `
+        INSERT INTO movies (title, year, runtime, genres)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at, version`
 
-	// Create a context with a 3-second timeout.
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	args := []any{title, pq.Array(genres), f.Limit(), f.Offset()}
-	// Use QueryContext() to execute the query. This returns a sql.Rows resultset
-	// containing the result.
-	rows, err := m.db.QueryContext(ctx, query, args...)
+
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, filter.Metadata{}, err
+		return err
 	}
+	defer tx.Rollback()
 
-	// Importantly, defer a call to rows.Close() to ensure that the resultset is closed
-	// before GetAll() returns.
-	defer rows.Close()
-	totalRecords := 0
-	// Initialize an empty slice to hold the movie data.
-	movies := []*models.Movie{}
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
 
-	// Use rows.Next to iterate through the rows in the resultset.
-	for rows.Next() {
-		// Initialize an empty Movie struct to hold the data for an individual movie.
-		var movie models.Movie
+	for _, movie := range movies {
+		args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+		err = stmt.QueryRowContext(ctx, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+		if err != nil {
+			return err
+		}
 
-		// Scan the values from the row into the Movie struct. Again, note that we're
-		// using the pq.Array() adapter on the genres field here.
-		err := rows.Scan(
-			&totalRecords,
-			&movie.ID,
-			&movie.CreatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			pq.Array(&movie.Genres),
-			&movie.Version,
-		)
+		err = setMovieExternalIDs(ctx, tx, movie)
 		if err != nil {
-			return nil, filter.Metadata{}, err
+			return err
 		}
 
-		// Add the Movie struct to the slice.
-		movies = append(movies, &movie)
+		err = insertMovieRevision(ctx, tx, actorID, movie.ID, movie.Version, models.MovieCreate, nil, movie)
+		if err != nil {
+			return err
+		}
 	}
 
-	// When the rows.Next() loop has finished, call rows.Err() to retrieve any error
-	// that was encountered during the iteration.
-	if err = rows.Err(); err != nil {
-		return nil, filter.Metadata{}, err
+	return tx.Commit()
+}
+
+// UpsertBatch creates or updates several movies in one transaction, matching each to
+// an existing movie by its external id from source. An existing movie has its title,
+// year, runtime and genres replaced if any of them differ, and keeps its other external
+// ids. Movies which are unchanged or in the trash are left alone. Each movie is set to
+// the state it is stored in, and the numbers created and updated are returned.
+func (m movie) UpsertBatch(actorID int64, source string, movies []*models.Movie) (created, updated int, err error) {
+	lookup := `
+        SELECT movie_id
+        FROM movie_external_ids
+        WHERE source = $1 AND external_id = $2`
+
+	insert := `
+        INSERT INTO movies (title, year, runtime, genres)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at, version`
+
+	update := `
+        UPDATE movies
+        SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
+        WHERE id = $5
+        RETURNING version`
+
+	// Each existing movie takes a lock and a few more statements than an insert, so
+	// allow longer than for InsertBatch.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
 	}
-	// Generate a Metadata struct, passing in the total record count and pagination
-	// parameters from the client.
-	metadata := filter.CalculateMetadata(totalRecords, f.Page, f.PageSize)
+	defer tx.Rollback()
 
-	// If everything went OK, then return the slice of movies.
-	return movies, metadata, nil
+	for _, movie := range movies {
+		var id int64
+		err = tx.QueryRowContext(ctx, lookup, source, movie.ExternalIDs[source]).Scan(&id)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+			err = tx.QueryRowContext(ctx, insert, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+			if err != nil {
+				return 0, 0, err
+			}
+			err = setMovieExternalIDs(ctx, tx, movie)
+			if err != nil {
+				return 0, 0, err
+			}
+			err = insertMovieRevision(ctx, tx, actorID, movie.ID, movie.Version, models.MovieCreate, nil, movie)
+			if err != nil {
+				return 0, 0, err
+			}
+			created++
+			continue
+		case err != nil:
+			return 0, 0, err
+		}
+
+		before, err := lockMovie(ctx, tx, id)
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			continue
+		case err != nil:
+			return 0, 0, err
+		}
+
+		after := *before
+		after.Title, after.Year, after.Runtime, after.Genres = movie.Title, movie.Year, movie.Runtime, movie.Genres
+		if sameMovieFields(before, &after) {
+			*movie = *before
+			continue
+		}
+
+		args := []any{after.Title, after.Year, after.Runtime, pq.Array(after.Genres), after.ID}
+		err = tx.QueryRowContext(ctx, update, args...).Scan(&after.Version)
+		if err != nil {
+			return 0, 0, err
+		}
+		err = insertMovieRevision(ctx, tx, actorID, after.ID, after.Version, models.MovieUpdate, before, &after)
+		if err != nil {
+			return 0, 0, err
+		}
+		*movie = after
+		updated++
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, 0, err
+	}
+	return created, updated, nil
+}
+
+// sameMovieFields reports whether two movies have the same title, year, runtime and
+// genres, which are the fields an update changes.
+func sameMovieFields(a, b *models.Movie) bool {
+	if a.Title != b.Title || a.Year != b.Year || a.Runtime != b.Runtime || len(a.Genres) != len(b.Genres) {
+		return false
+	}
+	for i := range a.Genres {
+		if a.Genres[i] != b.Genres[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lockMovie reads a movie that isn't in the trash and locks its row until the end of
+// the transaction, so that the state recorded in a revision is the one replaced.
+func lockMovie(ctx context.Context, tx *sql.Tx, id int64) (*models.Movie, error) {
+	query := `
+        SELECT id, created_at, title, year, runtime, genres, version, rating, votes
+        FROM movies
+        WHERE id = $1 AND deleted_at IS NULL
+        FOR UPDATE`
+
+	movie := new(models.Movie)
+	err := tx.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.Rating,
+		&movie.Votes,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	movie.ExternalIDs, err = movieExternalIDs(ctx, tx, movie.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return movie, nil
+}
+
+// A DuplicateExternalIDError means a movie was given an external id which already
+// belongs to another movie, which may be in the trash. It matches
+// ErrDuplicateExternalID with errors.Is.
+type DuplicateExternalIDError struct {
+	Source     string
+	ExternalID string
+}
+
+func (e *DuplicateExternalIDError) Error() string {
+	return fmt.Sprintf("duplicate %s id %s", e.Source, e.ExternalID)
+}
+
+func (e *DuplicateExternalIDError) Unwrap() error {
+	return ErrDuplicateExternalID
+}
+
+// movieExternalIDs returns a movie's external ids keyed by source, or nil if it has
+// none. It takes either the database or a transaction.
+func movieExternalIDs(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+}, movieID int64) (map[string]string, error) {
+	query := `
+        SELECT source, external_id
+        FROM movie_external_ids
+        WHERE movie_id = $1`
+
+	rows, err := q.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids map[string]string
+	for rows.Next() {
+		var source, id string
+		if err := rows.Scan(&source, &id); err != nil {
+			return nil, err
+		}
+		if ids == nil {
+			ids = map[string]string{}
+		}
+		ids[source] = id
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// setMovieExternalIDs replaces a movie's external ids with those on the movie. It
+// returns a DuplicateExternalIDError for the first id which belongs to another movie.
+func setMovieExternalIDs(ctx context.Context, tx *sql.Tx, movie *models.Movie) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM movie_external_ids WHERE movie_id = $1`, movie.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO movie_external_ids (source, external_id, movie_id)
+        VALUES ($1, $2, $3)`
+
+	sources := make([]string, 0, len(movie.ExternalIDs))
+	for source := range movie.ExternalIDs {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		id := movie.ExternalIDs[source]
+		_, err = tx.ExecContext(ctx, query, source, id, movie.ID)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "movie_external_ids_pkey"`:
+				return &DuplicateExternalIDError{Source: source, ExternalID: id}
+			default:
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// insertMovieRevision records a change to a movie made by the user actorID. The movie
+// is stored in the same JSON form the API returns it in, so a revision can be read back
+// into a Movie.
+func insertMovieRevision(ctx context.Context, tx *sql.Tx, actorID, movieID int64, version int32, action string, before, after *models.Movie) error {
+	query := `
+        INSERT INTO movie_revisions (movie_id, version, user_id, action, before, after)
+        VALUES ($1, $2, $3, $4, $5, $6)`
+
+	beforeJSON, err := movieJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := movieJSON(after)
+	if err != nil {
+		return err
+	}
+
+	// Changes made outside of a request, such as from the command line, have no user.
+	userID := sql.NullInt64{Int64: actorID, Valid: actorID > 0}
+
+	_, err = tx.ExecContext(ctx, query, movieID, version, userID, action, beforeJSON, afterJSON)
+	return err
+}
+
+// movieJSON returns nil for a nil movie so that it is stored as NULL.
+func movieJSON(movie *models.Movie) ([]byte, error) {
+	if movie == nil {
+		return nil, nil
+	}
+	return json.Marshal(movie)
+}
+
+// movieListWhere is the WHERE clause shared by both list queries. Every condition
+// is written so that it matches all rows when its parameter is left at its zero
+// value, and the placeholders are bound by movieListArgs().
+const movieListWhere = `
+        WHERE deleted_at IS NULL
+        AND ($1 = '' OR to_tsvector('simple', title) @@ plainto_tsquery('simple', $1)
+             OR id IN (SELECT movie_id FROM movie_titles
+                       WHERE search_vector @@ plainto_tsquery(search_config, $1)))
+        AND (genres @> $2 OR $2 = '{}')
+        AND (genres && $3 OR $3 = '{}')
+        AND NOT (genres && $4)
+        AND (year >= $5 OR $5 = 0)
+        AND (year <= $6 OR $6 = 0)
+        AND (runtime >= $7 OR $7 = 0)
+        AND (runtime <= $8 OR $8 = 0)
+        AND ($9 = '' OR to_tsvector('simple', title) @@ to_tsquery('simple', $9)
+             OR id IN (SELECT movie_id FROM movie_titles
+                       WHERE search_vector @@ to_tsquery(search_config, $9)))
+        AND (id IN (SELECT movie_id FROM movie_credits WHERE person_id = $10) OR $10 = 0)
+        AND (id IN (SELECT movie_id FROM collection_movies WHERE collection_id = $11) OR $11 = 0)`
+
+// The search rank and highlighted title of each movie for the q parameter, which is
+// bound to $9 by movieListArgs(). Both use the same to_tsvector('simple', title)
+// expression as movies_title_idx so the match itself is served by that index. A movie
+// ranks by whichever of its titles, original or alternate, matches best, and alternate
+// titles are parsed with their own language's configuration.
+const (
+	movieRankExpr = `GREATEST(ts_rank(to_tsvector('simple', title), to_tsquery('simple', $9)),
+            COALESCE((SELECT max(ts_rank(movie_titles.search_vector, to_tsquery(movie_titles.search_config, $9)))
+                      FROM movie_titles WHERE movie_titles.movie_id = movies.id), 0))`
+	movieSnippetExpr = `ts_headline('simple', title, to_tsquery('simple', $9), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')`
+)
+
+// movieSearchColumns returns the rank and snippet columns of the list and export
+// queries. Without a search query every movie would rank 0 with an empty snippet, so
+// the expressions, and the subquery on movie_titles the rank needs, are only used when
+// there is one. Sorting by rank requires a search query, so the rank sort always has
+// them.
+func movieSearchColumns(f filter.MovieFilter) string {
+	if f.TSQuery() == "" {
+		return `0::real, ''`
+	}
+	return movieRankExpr + ", " + movieSnippetExpr
+}
+
+// movieListArgs returns the values for the placeholders in movieListWhere. Queries
+// using it number any further placeholders from len(args)+1.
+func movieListArgs(f filter.MovieFilter) []any {
+	return []any{
+		f.Title,
+		pq.Array(nonNil(f.Genres)),
+		pq.Array(nonNil(f.GenresAny)),
+		pq.Array(nonNil(f.ExcludeGenres)),
+		f.YearMin,
+		f.YearMax,
+		f.RuntimeMin,
+		f.RuntimeMax,
+		f.TSQuery(),
+		f.PersonID,
+		f.CollectionID,
+	}
+}
+
+// nonNil makes sure an empty list is sent to Postgres as '{}' rather than NULL, which
+// would make the array comparisons in movieListWhere return NULL for every row.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// movieSortExpr returns the SQL expression to sort the list by. Every sort is a column
+// of the movies table apart from rank, which is computed from the search query.
+func movieSortExpr(f filter.Filter) string {
+	if f.SortColumn() == "rank" {
+		return movieRankExpr
+	}
+	return f.SortColumn()
+}
+
+func (m movie) GetAll(mf filter.MovieFilter) ([]*models.Movie, filter.Metadata, error) {
+	if mf.UseCursor {
+		return m.getAllKeyset(mf)
+	}
+	f := mf.Filter
+
+	args := movieListArgs(mf)
+	args = append(args, f.Limit(), f.Offset())
+
+	// Construct the SQL query to retrieve all movie records.
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(),id, created_at, title, year, runtime, genres, version, rating, votes, %s
+        FROM movies
+        %s
+        ORDER BY %s %s, id ASC
+        LIMIT $%d OFFSET $%d`, movieSearchColumns(mf), movieListWhere,
+		movieSortExpr(f), f.SortDirection(), len(args)-1, len(args))
+
+	// Create a context with a 3-second timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	// Use QueryContext() to execute the query. This returns a sql.Rows resultset
+	// containing the result.
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+
+	// Importantly, defer a call to rows.Close() to ensure that the resultset is closed
+	// before GetAll() returns.
+	defer rows.Close()
+	totalRecords := 0
+	// Initialize an empty slice to hold the movie data.
+	movies := []*models.Movie{}
+
+	// Use rows.Next to iterate through the rows in the resultset.
+	for rows.Next() {
+		// Initialize an empty Movie struct to hold the data for an individual movie.
+		var movie models.Movie
+
+		// Scan the values from the row into the Movie struct. Again, note that we're
+		// using the pq.Array() adapter on the genres field here.
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.Votes,
+			&movie.Rank,
+			&movie.Snippet,
+		)
+		if err != nil {
+			return nil, filter.Metadata{}, err
+		}
+
+		// Add the Movie struct to the slice.
+		movies = append(movies, &movie)
+	}
+
+	// When the rows.Next() loop has finished, call rows.Err() to retrieve any error
+	// that was encountered during the iteration.
+	if err = rows.Err(); err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	// Generate a Metadata struct, passing in the total record count and pagination
+	// parameters from the client.
+	metadata := filter.CalculateMetadata(totalRecords, f.Page, f.PageSize)
+
+	// If everything went OK, then return the slice of movies.
+	return movies, metadata, nil
+}
+
+// GetAllDeleted retrieves a page of the movies in the trash.
+func (m movie) GetAllDeleted(f filter.Filter) ([]*models.Movie, filter.Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, rating, votes, deleted_at
+        FROM movies
+        WHERE deleted_at IS NOT NULL
+        ORDER BY %s %s, id ASC
+        LIMIT $1 OFFSET $2`, f.SortColumn(), f.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, f.Limit(), f.Offset())
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*models.Movie{}
+
+	for rows.Next() {
+		var movie models.Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.Votes,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, filter.Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, filter.Metadata{}, err
+	}
+
+	return movies, filter.CalculateMetadata(totalRecords, f.Page, f.PageSize), nil
+}
+
+// movieExportBatchSize is the number of rows fetched from the export cursor at a time.
+const movieExportBatchSize = 500
+
+// Export calls fn with every movie matching the filter, in the filter's sort order.
+// Pagination is ignored. The rows are read through a server-side cursor a batch at a
+// time, so memory use doesn't grow with the size of the catalogue.
+//
+// Unlike the other queries an export can take minutes, so rather than a fixed timeout
+// it runs until ctx is done, which lets the caller stop it when the client goes away.
+func (m movie) Export(ctx context.Context, mf filter.MovieFilter, fn func(*models.Movie) error) error {
+	f := mf.Filter
+
+	declare := fmt.Sprintf(`
+        DECLARE movie_export NO SCROLL CURSOR FOR
+        SELECT id, created_at, title, year, runtime, genres, version, rating, votes, %s
+        FROM movies
+        %s
+        ORDER BY %s %s, id ASC`, movieSearchColumns(mf), movieListWhere,
+		movieSortExpr(f), f.SortDirection())
+	fetch := fmt.Sprintf(`FETCH FORWARD %d FROM movie_export`, movieExportBatchSize)
+
+	// A cursor only lives as long as the transaction that declared it.
+	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, declare, movieListArgs(mf)...)
+	if err != nil {
+		return err
+	}
+
+	for {
+		n, err := exportBatch(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		if n < movieExportBatchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+// exportBatch fetches the next batch of rows from the export cursor and passes each to
+// fn, returning the number of rows fetched.
+func exportBatch(ctx context.Context, tx *sql.Tx, fetch string, fn func(*models.Movie) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var movie models.Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.Votes,
+			&movie.Rank,
+			&movie.Snippet,
+		)
+		if err != nil {
+			return n, err
+		}
+		n++
+
+		if err := fn(&movie); err != nil {
+			return n, err
+		}
+	}
+
+	return n, rows.Err()
+}
+
+// getAllKeyset retrieves a page of movies that starts at the filter cursor rather than
+// at an OFFSET. Postgres can seek straight to the cursor position instead of reading
+// and discarding every earlier row, and rows inserted or deleted on earlier pages
+// can't shift the page boundaries. There is no total count, as that would need the
+// full scan that keyset pagination avoids.
+func (m movie) getAllKeyset(mf filter.MovieFilter) ([]*models.Movie, filter.Metadata, error) {
+	f := mf.Filter
+
+	// Fetch one more row than the page size so that we know whether there is another
+	// page without having to count.
+	args := movieListArgs(mf)
+	args = append(args, f.Limit()+1)
+	limitArg := len(args)
+	args = append(args, f.KeysetArgs()...)
+
+	sortExpr := movieSortExpr(f)
+	query := fmt.Sprintf(`
+        SELECT id, created_at, title, year, runtime, genres, version, rating, votes, %s
+        FROM movies
+        %s
+        AND %s
+        ORDER BY %s
+        LIMIT $%d`, movieSearchColumns(mf), movieListWhere,
+		f.KeysetCondition(sortExpr, limitArg+1, limitArg+2), f.KeysetOrderBy(sortExpr), limitArg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*models.Movie{}
+
+	for rows.Next() {
+		var movie models.Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.Votes,
+			&movie.Rank,
+			&movie.Snippet,
+		)
+		if err != nil {
+			return nil, filter.Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, filter.Metadata{}, err
+	}
+
+	more := len(movies) > f.Limit()
+	if more {
+		movies = movies[:f.Limit()]
+	}
+
+	// A previous page is read backwards from the cursor, so put it back into the
+	// requested order.
+	if f.Backward() {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+	}
+
+	if len(movies) == 0 {
+		return movies, filter.CalculateCursorMetadata(f, nil, nil, false), nil
+	}
+
+	first := movieCursor(f, movies[0])
+	last := movieCursor(f, movies[len(movies)-1])
+	return movies, filter.CalculateCursorMetadata(f, &first, &last, more), nil
+}
+
+// movieCursor returns the cursor pointing at a movie for the filter's sort column.
+func movieCursor(f filter.Filter, movie *models.Movie) filter.Cursor {
+	c := filter.Cursor{Sort: f.Sort, ID: movie.ID}
+
+	switch f.SortColumn() {
+	case "id":
+		c.Value = strconv.FormatInt(movie.ID, 10)
+	case "title":
+		c.Value = movie.Title
+	case "year":
+		c.Value = strconv.FormatInt(int64(movie.Year), 10)
+	case "runtime":
+		c.Value = strconv.FormatInt(int64(movie.Runtime), 10)
+	case "rank":
+		// Format the rank with the shortest representation that parses back to the
+		// same float32, so the equality check in the keyset condition still holds.
+		c.Value = strconv.FormatFloat(float64(movie.Rank), 'g', -1, 32)
+	case "rating":
+		c.Value = strconv.FormatFloat(float64(movie.Rating), 'g', -1, 32)
+	default:
+		panic("no cursor value for sort column: " + f.SortColumn())
+	}
+
+	return c
+}
+
+// GetSuggestions returns up to limit movies whose titles contain something similar to
+// q, best matches first. It uses word similarity rather than plain similarity so that
+// a short or misspelt term such as "godfater" still scores highly against a longer
+// title such as "The Godfather".
+func (m movie) GetSuggestions(q string, threshold float64, limit int) ([]*models.MovieSuggestion, error) {
+	// The <% operator is what lets Postgres use movies_title_trgm_idx, but it compares
+	// against the pg_trgm.word_similarity_threshold setting rather than an argument.
+	// We set it with set_config() inside a transaction so that the setting is local to
+	// this query and doesn't leak into other users of the pooled connection.
+	query := `
+        SELECT id, title, year, word_similarity($1, title) AS score
+        FROM movies
+        WHERE $1 <% title AND deleted_at IS NULL
+        ORDER BY score DESC, similarity($1, title) DESC, id ASC
+        LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`,
+		strconv.FormatFloat(threshold, 'f', -1, 64))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, query, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*models.MovieSuggestion{}
+
+	for rows.Next() {
+		var s models.MovieSuggestion
+
+		err := rows.Scan(&s.ID, &s.Title, &s.Year, &s.Score)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, tx.Commit()
+}
+
+// GetRevisions retrieves a page of the revisions of a movie, including a movie in the
+// trash.
+func (m movie) GetRevisions(movieID int64, f filter.Filter) ([]*models.MovieRevision, filter.Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, movie_id, version, user_id, action, before, after
+        FROM movie_revisions
+        WHERE movie_id = $1
+        ORDER BY %s %s
+        LIMIT $2 OFFSET $3`, f.SortColumn(), f.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, movieID, f.Limit(), f.Offset())
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*models.MovieRevision{}
+
+	for rows.Next() {
+		var revision models.MovieRevision
+		var before, after []byte
+
+		err := rows.Scan(
+			&totalRecords,
+			&revision.ID,
+			&revision.CreatedAt,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.UserID,
+			&revision.Action,
+			&before,
+			&after,
+		)
+		if err != nil {
+			return nil, filter.Metadata{}, err
+		}
+		if err := scanRevisionMovies(&revision, before, after); err != nil {
+			return nil, filter.Metadata{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, filter.Metadata{}, err
+	}
+
+	return revisions, filter.CalculateMetadata(totalRecords, f.Page, f.PageSize), nil
+}
+
+func (m movie) GetRevision(movieID int64, version int32) (*models.MovieRevision, error) {
+	if movieID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, movie_id, version, user_id, action, before, after
+        FROM movie_revisions
+        WHERE movie_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var revision models.MovieRevision
+	var before, after []byte
+
+	err := m.db.QueryRowContext(ctx, query, movieID, version).Scan(
+		&revision.ID,
+		&revision.CreatedAt,
+		&revision.MovieID,
+		&revision.Version,
+		&revision.UserID,
+		&revision.Action,
+		&before,
+		&after,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if err := scanRevisionMovies(&revision, before, after); err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+// scanRevisionMovies decodes the before and after columns of a revision, either of
+// which may be NULL.
+func scanRevisionMovies(revision *models.MovieRevision, before, after []byte) error {
+	if before != nil {
+		revision.Before = new(models.Movie)
+		if err := json.Unmarshal(before, revision.Before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		revision.After = new(models.Movie)
+		if err := json.Unmarshal(after, revision.After); err != nil {
+			return err
+		}
+	}
+	return nil
 }
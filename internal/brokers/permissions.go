@@ -3,22 +3,30 @@ package brokers
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/lib/pq"
 	"github.com/rwx-yxu/greenlight/internal/models"
 )
 
+var (
+	ErrUnknownPermission = errors.New("unknown permission code")
+)
+
 type permission struct {
 	db *sql.DB
 }
 
 type PermissionWriter interface {
 	InsertForUser(userId int64, codes ...string) error
+	GrantForUser(actorID, userID int64, codes ...string) error
+	DeleteForUser(actorID, userID int64, codes ...string) error
 }
 
 type PermissionReader interface {
 	GetAllForUser(userID int64) (models.Permissions, error)
+	GetHistoryForUser(userID int64) ([]*models.PermissionChange, error)
 }
 
 type PermissionReadWriter interface {
@@ -33,14 +41,20 @@ func NewPermission(db *sql.DB) PermissionReadWriter {
 // The GetAllForUser() method returns all permission codes for a specific user in a
 // Permissions slice. The code in this method should feel very familiar --- it uses the
 // standard pattern that we've already seen before for retrieving multiple data rows in
-// an SQL query.
+// an SQL query. The codes are the union of those granted to the user directly and
+// those bundled by any role the user has been assigned, and UNION removes duplicates.
 func (p permission) GetAllForUser(userID int64) (models.Permissions, error) {
 	query := `
         SELECT permissions.code
         FROM permissions
         INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-        INNER JOIN users ON users_permissions.user_id = users.id
-        WHERE users.id = $1`
+        WHERE users_permissions.user_id = $1
+        UNION
+        SELECT permissions.code
+        FROM permissions
+        INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+        INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+        WHERE users_roles.user_id = $1`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -84,3 +98,148 @@ func (p permission) InsertForUser(userID int64, codes ...string) error {
 	_, err := p.db.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
+
+// GrantForUser adds the provided permission codes for a user on behalf of the actor,
+// recording an audit row for every code that the user didn't already have. Unknown
+// codes return ErrUnknownPermission and an unknown user returns ErrRecordNotFound.
+func (p permission) GrantForUser(actorID, userID int64, codes ...string) error {
+	query := `
+        WITH granted AS (
+            INSERT INTO users_permissions
+            SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+            ON CONFLICT DO NOTHING
+            RETURNING permission_id
+        )
+        INSERT INTO users_permissions_audit (user_id, actor_id, code, action)
+        SELECT $1, $3, permissions.code, $4
+        FROM granted
+        INNER JOIN permissions ON permissions.id = granted.permission_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkPermissionCodes(ctx, tx, codes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, userID, pq.Array(codes), actorID, models.PermissionGrant)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "users_permissions" violates foreign key constraint "users_permissions_user_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteForUser revokes the provided permission codes from a user on behalf of the
+// actor, recording an audit row for every code that the user actually had. Only
+// directly granted codes are affected; codes that come from a role stay in place
+// until the role is unassigned.
+func (p permission) DeleteForUser(actorID, userID int64, codes ...string) error {
+	query := `
+        WITH revoked AS (
+            DELETE FROM users_permissions
+            USING permissions
+            WHERE users_permissions.permission_id = permissions.id
+            AND users_permissions.user_id = $1
+            AND permissions.code = ANY($2)
+            RETURNING permissions.code
+        )
+        INSERT INTO users_permissions_audit (user_id, actor_id, code, action)
+        SELECT $1, $3, revoked.code, $4
+        FROM revoked`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkPermissionCodes(ctx, tx, codes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, userID, pq.Array(codes), actorID, models.PermissionRevoke)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkPermissionCodes returns ErrUnknownPermission unless every code exists in the
+// permissions table. The codes are expected to have been checked for duplicates.
+func checkPermissionCodes(ctx context.Context, tx *sql.Tx, codes []string) error {
+	query := `
+        SELECT count(*) FROM permissions WHERE code = ANY($1)`
+
+	var count int
+	err := tx.QueryRowContext(ctx, query, pq.Array(codes)).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count != len(codes) {
+		return ErrUnknownPermission
+	}
+
+	return nil
+}
+
+// GetHistoryForUser returns every grant and revoke made for a user, newest first.
+func (p permission) GetHistoryForUser(userID int64) ([]*models.PermissionChange, error) {
+	query := `
+        SELECT id, created_at, user_id, actor_id, code, action, role
+        FROM users_permissions_audit
+        WHERE user_id = $1
+        ORDER BY id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*models.PermissionChange{}
+
+	for rows.Next() {
+		var change models.PermissionChange
+
+		err := rows.Scan(
+			&change.ID,
+			&change.CreatedAt,
+			&change.UserID,
+			&change.ActorID,
+			&change.Code,
+			&change.Action,
+			&change.Role,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, &change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
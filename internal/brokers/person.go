@@ -0,0 +1,133 @@
+package brokers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+type person struct {
+	db *sql.DB
+}
+
+type PersonReader interface {
+	GetByID(id int64) (*models.Person, error)
+}
+
+type PersonWriter interface {
+	Insert(p *models.Person) error
+	Update(p *models.Person) error
+}
+
+type PersonDeleter interface {
+	DeleteByID(id int64) error
+}
+
+type PersonReadWriteDeleter interface {
+	PersonReader
+	PersonWriter
+	PersonDeleter
+}
+
+func NewPerson(db *sql.DB) PersonReadWriteDeleter {
+	return &person{db: db}
+}
+
+func (p person) GetByID(id int64) (*models.Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, name, version
+        FROM people
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	person := new(models.Person)
+	err := p.db.QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Name,
+		&person.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return person, nil
+}
+
+func (p person) Insert(person *models.Person) error {
+	query := `
+        INSERT INTO people (name)
+        VALUES ($1)
+        RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return p.db.QueryRowContext(ctx, query, person.Name).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (p person) Update(person *models.Person) error {
+	query := `
+        UPDATE people
+        SET name = $1, version = version + 1
+        WHERE id = $2 AND version = $3
+        RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := p.db.QueryRowContext(ctx, query, person.Name, person.ID, person.Version).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteByID deletes a person along with all of their credits.
+func (p person) DeleteByID(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM people
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := p.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package brokers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+type rating struct {
+	db *sql.DB
+}
+
+type RatingWriter interface {
+	Upsert(rating *models.Rating) error
+}
+
+type RatingDeleter interface {
+	Delete(movieID, userID int64) error
+}
+
+type RatingWriteDeleter interface {
+	RatingWriter
+	RatingDeleter
+}
+
+func NewRating(db *sql.DB) RatingWriteDeleter {
+	return &rating{db: db}
+}
+
+// Upsert sets a user's score for a movie, replacing any score they gave it before. It
+// returns ErrRecordNotFound if the movie doesn't exist or is in the trash.
+func (r rating) Upsert(rating *models.Rating) error {
+	query := `
+        INSERT INTO ratings (movie_id, user_id, score)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (movie_id, user_id) DO UPDATE
+        SET score = EXCLUDED.score, updated_at = NOW()
+        RETURNING created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockRatedMovie(ctx, tx, rating.MovieID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, rating.MovieID, rating.UserID, rating.Score).Scan(&rating.CreatedAt, &rating.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	err = updateMovieRating(ctx, tx, rating.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a user's score for a movie. It returns ErrRecordNotFound if the movie
+// doesn't exist, is in the trash or the user hasn't rated it.
+func (r rating) Delete(movieID, userID int64) error {
+	query := `
+        DELETE FROM ratings
+        WHERE movie_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockRatedMovie(ctx, tx, movieID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, query, movieID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = updateMovieRating(ctx, tx, movieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockRatedMovie locks the row of a movie that is being rated. Ratings for the same
+// movie then change one at a time, so each recalculation of the average sees every
+// rating committed before it.
+func lockRatedMovie(ctx context.Context, tx *sql.Tx, movieID int64) error {
+	query := `
+        SELECT id FROM movies
+        WHERE id = $1 AND deleted_at IS NULL
+        FOR NO KEY UPDATE`
+
+	err := tx.QueryRowContext(ctx, query, movieID).Scan(&movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// updateMovieRating recalculates the average score and vote count stored on a movie.
+// It doesn't bump the movie's version, as rating a movie isn't an edit.
+func updateMovieRating(ctx context.Context, tx *sql.Tx, movieID int64) error {
+	query := `
+        UPDATE movies
+        SET rating = COALESCE(r.average, 0), votes = r.votes
+        FROM (
+            SELECT avg(score)::real AS average, count(*) AS votes
+            FROM ratings
+            WHERE movie_id = $1
+        ) r
+        WHERE id = $1`
+
+	_, err := tx.ExecContext(ctx, query, movieID)
+	return err
+}
@@ -0,0 +1,254 @@
+package brokers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rwx-yxu/greenlight/internal/filter"
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+var ErrDuplicateReview = errors.New("duplicate review")
+
+type review struct {
+	db *sql.DB
+}
+
+type ReviewReader interface {
+	GetByID(id int64) (*models.Review, error)
+	GetAllForMovie(movieID, viewerID int64, f filter.Filter) ([]*models.Review, filter.Metadata, error)
+	GetAllByStatus(status string, f filter.Filter) ([]*models.Review, filter.Metadata, error)
+}
+
+type ReviewWriter interface {
+	Insert(review *models.Review) error
+	Update(review *models.Review) error
+	UpdateStatus(review *models.Review) error
+}
+
+type ReviewDeleter interface {
+	DeleteByID(id int64) error
+}
+
+type ReviewReadWriteDeleter interface {
+	ReviewReader
+	ReviewWriter
+	ReviewDeleter
+}
+
+func NewReview(db *sql.DB) ReviewReadWriteDeleter {
+	return &review{db: db}
+}
+
+const reviewColumns = `id, created_at, updated_at, movie_id, user_id, body, status, moderated_by, moderated_at, version`
+
+// reviewScanArgs returns the scan destinations for reviewColumns.
+func reviewScanArgs(r *models.Review) []any {
+	return []any{
+		&r.ID,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+		&r.MovieID,
+		&r.UserID,
+		&r.Body,
+		&r.Status,
+		&r.ModeratedBy,
+		&r.ModeratedAt,
+		&r.Version,
+	}
+}
+
+func (r review) GetByID(id int64) (*models.Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT ` + reviewColumns + `
+        FROM reviews
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	review := new(models.Review)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(reviewScanArgs(review)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return review, nil
+}
+
+// GetAllForMovie retrieves a page of the reviews of a movie that viewerID is allowed
+// to see: every approved review, and the viewer's own review whatever its status.
+func (r review) GetAllForMovie(movieID, viewerID int64, f filter.Filter) ([]*models.Review, filter.Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM reviews
+        WHERE movie_id = $1 AND (status = $2 OR user_id = $3)
+        ORDER BY %s %s, id ASC
+        LIMIT $4 OFFSET $5`, reviewColumns, f.SortColumn(), f.SortDirection())
+
+	args := []any{movieID, models.ReviewApproved, viewerID, f.Limit(), f.Offset()}
+
+	return r.list(query, args, f)
+}
+
+// GetAllByStatus retrieves a page of the reviews of every movie with the given status,
+// for moderators to work through.
+func (r review) GetAllByStatus(status string, f filter.Filter) ([]*models.Review, filter.Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM reviews
+        WHERE status = $1
+        ORDER BY %s %s, id ASC
+        LIMIT $2 OFFSET $3`, reviewColumns, f.SortColumn(), f.SortDirection())
+
+	args := []any{status, f.Limit(), f.Offset()}
+
+	return r.list(query, args, f)
+}
+
+// list runs a paginated review query which selects the total count followed by
+// reviewColumns.
+func (r review) list(query string, args []any, f filter.Filter) ([]*models.Review, filter.Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*models.Review{}
+
+	for rows.Next() {
+		var review models.Review
+
+		err := rows.Scan(append([]any{&totalRecords}, reviewScanArgs(&review)...)...)
+		if err != nil {
+			return nil, filter.Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, filter.Metadata{}, err
+	}
+
+	return reviews, filter.CalculateMetadata(totalRecords, f.Page, f.PageSize), nil
+}
+
+// Insert creates a pending review. It returns ErrRecordNotFound if the movie doesn't
+// exist or is in the trash, and ErrDuplicateReview if the user has already reviewed
+// the movie.
+func (r review) Insert(review *models.Review) error {
+	query := `
+        INSERT INTO reviews (movie_id, user_id, body)
+        SELECT id, $2, $3
+        FROM movies
+        WHERE id = $1 AND deleted_at IS NULL
+        RETURNING ` + reviewColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, review.MovieID, review.UserID, review.Body).Scan(reviewScanArgs(review)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_movie_id_user_id_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Update saves a new body for a review. The edited text hasn't been moderated, so the
+// review goes back to pending.
+func (r review) Update(review *models.Review) error {
+	query := `
+        UPDATE reviews
+        SET body = $1, status = $2, moderated_by = NULL, moderated_at = NULL,
+            updated_at = NOW(), version = version + 1
+        WHERE id = $3 AND version = $4
+        RETURNING ` + reviewColumns
+
+	args := []any{review.Body, models.ReviewPending, review.ID, review.Version}
+
+	return r.update(query, args, review)
+}
+
+// UpdateStatus records a moderator's decision on a review. The moderator and time are
+// taken from review.ModeratedBy and the current time.
+func (r review) UpdateStatus(review *models.Review) error {
+	query := `
+        UPDATE reviews
+        SET status = $1, moderated_by = $2, moderated_at = NOW(), version = version + 1
+        WHERE id = $3 AND version = $4
+        RETURNING ` + reviewColumns
+
+	args := []any{review.Status, review.ModeratedBy, review.ID, review.Version}
+
+	return r.update(query, args, review)
+}
+
+func (r review) update(query string, args []any, review *models.Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(reviewScanArgs(review)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r review) DeleteByID(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM reviews
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,466 @@
+package brokers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+var (
+	ErrDuplicateRoleName = errors.New("duplicate role name")
+)
+
+type role struct {
+	db *sql.DB
+}
+
+type RoleReader interface {
+	GetByID(id int64) (*models.Role, error)
+	GetAll() ([]*models.Role, error)
+}
+
+type RoleWriter interface {
+	Insert(role *models.Role) error
+	Update(actorID int64, role *models.Role) error
+	InsertForUser(actorID, roleID, userID int64) error
+	DeleteForUser(actorID, roleID, userID int64) error
+}
+
+type RoleDeleter interface {
+	DeleteByID(actorID, id int64) error
+}
+
+type RoleReadWriteDeleter interface {
+	RoleReader
+	RoleWriter
+	RoleDeleter
+}
+
+func NewRole(db *sql.DB) RoleReadWriteDeleter {
+	return &role{db: db}
+}
+
+// The permission codes of each role are aggregated into a single array column so that
+// a role and all of its permissions can be read in one query. The FILTER clause stops
+// a role without any permissions from returning {NULL}.
+const roleSelect = `
+        SELECT roles.id, roles.created_at, roles.name, roles.description, roles.version,
+            COALESCE(array_agg(permissions.code ORDER BY permissions.code)
+                FILTER (WHERE permissions.code IS NOT NULL), '{}')
+        FROM roles
+        LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+        LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id`
+
+func (r role) GetByID(id int64) (*models.Role, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := roleSelect + `
+        WHERE roles.id = $1
+        GROUP BY roles.id`
+
+	role := new(models.Role)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&role.ID,
+		&role.CreatedAt,
+		&role.Name,
+		&role.Description,
+		&role.Version,
+		pq.Array((*[]string)(&role.Permissions)),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return role, nil
+}
+
+func (r role) GetAll() ([]*models.Role, error) {
+	query := roleSelect + `
+        GROUP BY roles.id
+        ORDER BY roles.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*models.Role{}
+
+	for rows.Next() {
+		var role models.Role
+
+		err := rows.Scan(
+			&role.ID,
+			&role.CreatedAt,
+			&role.Name,
+			&role.Description,
+			&role.Version,
+			pq.Array((*[]string)(&role.Permissions)),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, &role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Insert adds the role and its permissions in a single transaction so that a role is
+// never visible without the permissions it was created with.
+func (r role) Insert(role *models.Role) error {
+	query := `
+        INSERT INTO roles (name, description)
+        VALUES ($1, $2)
+        RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, role.Name, role.Description).Scan(&role.ID, &role.CreatedAt, &role.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "roles_name_key"`:
+			return ErrDuplicateRoleName
+		default:
+			return err
+		}
+	}
+
+	err = setRolePermissions(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Update replaces the name, description and permissions of a role, using the version
+// number to detect concurrent edits in the same way as the movie broker. Every user
+// holding the role gains or loses the permissions added to or removed from it, so
+// those changes are recorded in the permissions audit on behalf of the actor.
+func (r role) Update(actorID int64, role *models.Role) error {
+	query := `
+        UPDATE roles
+        SET name = $1, description = $2, version = version + 1
+        WHERE id = $3 AND version = $4
+        RETURNING version`
+
+	args := []any{role.Name, role.Description, role.ID, role.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&role.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "roles_name_key"`:
+			return ErrDuplicateRoleName
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	// The UPDATE above holds the role's row lock, so its permissions can't change
+	// between reading them here and replacing them below.
+	old, err := rolePermissionCodes(ctx, tx, role.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM roles_permissions WHERE role_id = $1`, role.ID)
+	if err != nil {
+		return err
+	}
+
+	err = setRolePermissions(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+
+	var granted, revoked []string
+	for _, code := range role.Permissions {
+		if !old.Include(code) {
+			granted = append(granted, code)
+		}
+	}
+	for _, code := range old {
+		if !role.Permissions.Include(code) {
+			revoked = append(revoked, code)
+		}
+	}
+
+	err = auditRoleHolders(ctx, tx, actorID, role.ID, granted, models.PermissionGrant)
+	if err != nil {
+		return err
+	}
+	err = auditRoleHolders(ctx, tx, actorID, role.ID, revoked, models.PermissionRevoke)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rolePermissionCodes returns the permission codes the role currently bundles.
+func rolePermissionCodes(ctx context.Context, tx *sql.Tx, roleID int64) (models.Permissions, error) {
+	query := `
+        SELECT permissions.code
+        FROM roles_permissions
+        INNER JOIN permissions ON permissions.id = roles_permissions.permission_id
+        WHERE roles_permissions.role_id = $1
+        ORDER BY permissions.code`
+
+	rows, err := tx.QueryContext(ctx, query, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes models.Permissions
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// setRolePermissions links every permission code of the role to it. If fewer rows are
+// inserted than codes were given then at least one code doesn't exist, and we return
+// ErrUnknownPermission so that the caller's transaction is rolled back.
+func setRolePermissions(ctx context.Context, tx *sql.Tx, role *models.Role) error {
+	if len(role.Permissions) == 0 {
+		return nil
+	}
+
+	query := `
+        INSERT INTO roles_permissions
+        SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+
+	result, err := tx.ExecContext(ctx, query, role.ID, pq.Array([]string(role.Permissions)))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != int64(len(role.Permissions)) {
+		return ErrUnknownPermission
+	}
+
+	return nil
+}
+
+// DeleteByID deletes a role on behalf of the actor, recording a revoke in the
+// permissions audit for each of its permissions and each user who held it.
+func (r role) DeleteByID(actorID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the role first so that it can't be edited or assigned between auditing
+	// its holders and deleting it.
+	err = tx.QueryRowContext(ctx, `SELECT id FROM roles WHERE id = $1 FOR UPDATE`, id).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	codes, err := rolePermissionCodes(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	err = auditRoleHolders(ctx, tx, actorID, id, codes, models.PermissionRevoke)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM roles WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertForUser assigns a role to a user on behalf of the actor, recording a grant
+// in the permissions audit for every permission the role bundles. Assigning a role
+// that the user already has is not an error and isn't audited again. If either the
+// role or the user doesn't exist the foreign key constraint fails and we return
+// ErrRecordNotFound.
+func (r role) InsertForUser(actorID, roleID, userID int64) error {
+	query := `
+        INSERT INTO users_roles (user_id, role_id)
+        VALUES ($1, $2)
+        ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, userID, roleID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "users_roles" violates foreign key constraint "users_roles_user_id_fkey"`,
+			err.Error() == `pq: insert or update on table "users_roles" violates foreign key constraint "users_roles_role_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return nil
+	}
+
+	err = auditRolePermissions(ctx, tx, actorID, roleID, userID, models.PermissionGrant)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteForUser unassigns a role from a user on behalf of the actor, recording a
+// revoke in the permissions audit for every permission the role bundles. The user
+// keeps any of those permissions that were also granted directly or by another role.
+func (r role) DeleteForUser(actorID, roleID, userID int64) error {
+	query := `
+        DELETE FROM users_roles
+        WHERE user_id = $1 AND role_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, userID, roleID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = auditRolePermissions(ctx, tx, actorID, roleID, userID, models.PermissionRevoke)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// auditRolePermissions records an audit row against the role's name for each of the
+// permissions it bundles, in the same transaction as the role is assigned or
+// unassigned.
+func auditRolePermissions(ctx context.Context, tx *sql.Tx, actorID, roleID, userID int64, action string) error {
+	query := `
+        INSERT INTO users_permissions_audit (user_id, actor_id, code, action, role)
+        SELECT $1, $2, permissions.code, $3, roles.name
+        FROM roles
+        INNER JOIN roles_permissions ON roles_permissions.role_id = roles.id
+        INNER JOIN permissions ON permissions.id = roles_permissions.permission_id
+        WHERE roles.id = $4
+        ORDER BY permissions.code`
+
+	_, err := tx.ExecContext(ctx, query, userID, actorID, action, roleID)
+	return err
+}
+
+// auditRoleHolders records an audit row against the role's name for each of the
+// given codes and each user who holds the role, in the same transaction as the role
+// is edited or deleted.
+func auditRoleHolders(ctx context.Context, tx *sql.Tx, actorID, roleID int64, codes []string, action string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+
+	query := `
+        INSERT INTO users_permissions_audit (user_id, actor_id, code, action, role)
+        SELECT users_roles.user_id, $1, codes.code, $2, roles.name
+        FROM roles
+        INNER JOIN users_roles ON users_roles.role_id = roles.id
+        CROSS JOIN unnest($3::text[]) AS codes(code)
+        WHERE roles.id = $4
+        ORDER BY users_roles.user_id, codes.code`
+
+	_, err := tx.ExecContext(ctx, query, actorID, action, pq.Array(codes), roleID)
+	return err
+}
@@ -0,0 +1,126 @@
+package brokers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+type title struct {
+	db *sql.DB
+}
+
+type TitleReader interface {
+	GetAllForMovies(movieIDs []int64) (map[int64][]*models.MovieTitle, error)
+}
+
+type TitleWriter interface {
+	Upsert(t *models.MovieTitle) error
+}
+
+type TitleDeleter interface {
+	Delete(movieID int64, language string) error
+}
+
+type TitleReadWriteDeleter interface {
+	TitleReader
+	TitleWriter
+	TitleDeleter
+}
+
+func NewTitle(db *sql.DB) TitleReadWriteDeleter {
+	return &title{db: db}
+}
+
+// GetAllForMovies returns the alternate titles of each of the given movies, ordered by
+// language. Movies without any are left out of the map.
+func (t title) GetAllForMovies(movieIDs []int64) (map[int64][]*models.MovieTitle, error) {
+	query := `
+        SELECT id, movie_id, language, title, search_config::text
+        FROM movie_titles
+        WHERE movie_id = ANY($1)
+        ORDER BY movie_id, language`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.db.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := map[int64][]*models.MovieTitle{}
+	for rows.Next() {
+		var mt models.MovieTitle
+		err := rows.Scan(&mt.ID, &mt.MovieID, &mt.Language, &mt.Title, &mt.SearchConfig)
+		if err != nil {
+			return nil, err
+		}
+		titles[mt.MovieID] = append(titles[mt.MovieID], &mt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return titles, nil
+}
+
+// Upsert sets a movie's title in a language, replacing any it already has. It returns
+// ErrRecordNotFound if the movie doesn't exist or is in the trash.
+func (t title) Upsert(mt *models.MovieTitle) error {
+	query := `
+        INSERT INTO movie_titles (movie_id, language, title, search_config, search_vector)
+        SELECT movies.id, $2, $3, $4::regconfig, to_tsvector($4::regconfig, $3)
+        FROM movies
+        WHERE movies.id = $1 AND movies.deleted_at IS NULL
+        ON CONFLICT ON CONSTRAINT movie_titles_movie_id_language_key
+        DO UPDATE SET title = EXCLUDED.title, search_config = EXCLUDED.search_config,
+            search_vector = EXCLUDED.search_vector
+        RETURNING id`
+
+	args := []any{mt.MovieID, mt.Language, mt.Title, mt.SearchConfig}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := t.db.QueryRowContext(ctx, query, args...).Scan(&mt.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t title) Delete(movieID int64, language string) error {
+	query := `
+        DELETE FROM movie_titles
+        WHERE movie_id = $1 AND language = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := t.db.ExecContext(ctx, query, movieID, language)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -18,6 +18,7 @@ type TokenWriter interface {
 
 type TokenDeleter interface {
 	DeleteAllForUser(scope string, userID int64) error
+	DeleteByHash(scope string, hash []byte) error
 }
 
 type TokenWriteDeleter interface {
@@ -54,3 +55,17 @@ func (t token) DeleteAllForUser(scope string, userID int64) error {
 	_, err := t.db.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteByHash removes a single token. Deleting a token that does not exist is not an
+// error, because either way the token can no longer be used.
+func (t token) DeleteByHash(scope string, hash []byte) error {
+	query := `
+        DELETE FROM tokens
+        WHERE scope = $1 AND hash = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.db.ExecContext(ctx, query, scope, hash)
+	return err
+}
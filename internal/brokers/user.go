@@ -21,7 +21,7 @@ type user struct {
 
 type UserReader interface {
 	GetByEmail(email string) (*models.User, error)
-	GetByToken(scope, tokenPlaintext string) (*models.User, error)
+	GetByToken(scope, tokenPlaintext string) (*models.User, time.Time, error)
 }
 
 type UserWriter interface {
@@ -133,14 +133,16 @@ func (u user) Update(user *models.User) error {
 	return nil
 }
 
-func (u user) GetByToken(scope, tokenPlaintext string) (*models.User, error) {
+// GetByToken returns the user the token belongs to along with the token's expiry,
+// so callers caching the lookup know how long it stays valid.
+func (u user) GetByToken(scope, tokenPlaintext string) (*models.User, time.Time, error) {
 	// Calculate the SHA-256 hash of the plaintext token provided by the client.
 	// Remember that this returns a byte *array* with length 32, not a slice.
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	// Set up the SQL query.
 	query := `
-        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version, tokens.expiry
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -155,6 +157,7 @@ func (u user) GetByToken(scope, tokenPlaintext string) (*models.User, error) {
 	args := []any{tokenHash[:], scope, time.Now()}
 
 	var user models.User
+	var expiry time.Time
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -169,16 +172,17 @@ func (u user) GetByToken(scope, tokenPlaintext string) (*models.User, error) {
 		&user.Password.Hash,
 		&user.Activated,
 		&user.Version,
+		&expiry,
 	)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrRecordNotFound
+			return nil, time.Time{}, ErrRecordNotFound
 		default:
-			return nil, err
+			return nil, time.Time{}, err
 		}
 	}
 
 	// Return the matching user.
-	return &user, nil
+	return &user, expiry, nil
 }
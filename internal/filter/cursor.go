@@ -0,0 +1,125 @@
+package filter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// A Cursor marks a position in a keyset paginated list: the value of the sort column
+// and the id of the last (or, for a previous page cursor, the first) record that the
+// client has already seen. The sort is included so that a cursor can't be reused with
+// a different sort, which would silently skip or repeat records.
+//
+// Cursors are handed to clients as opaque strings, so the encoding can change without
+// breaking anyone.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"i"`
+	Prev  bool   `json:"p,omitempty"`
+}
+
+func EncodeCursor(c Cursor) string {
+	js, err := json.Marshal(c)
+	if err != nil {
+		// A Cursor only holds strings, an int and a bool, so this can't happen.
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(js, &c); err != nil || c.ID < 1 {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// KeysetCondition returns the SQL condition selecting the records after the cursor,
+// or before it for a previous page cursor, in the current sort order. col is the SQL
+// expression being sorted on, which is normally just SortColumn() but may be a
+// computed value such as a search rank. valueArg and idArg are the placeholder numbers
+// that the caller binds to KeysetArgs(). If there is no cursor every record matches.
+//
+// Lists are always ordered by the sort column and then by id ascending, so the id
+// comparison doesn't depend on the sort direction.
+func (f Filter) KeysetCondition(col string, valueArg, idArg int) string {
+	c, ok := f.cursor()
+	if !ok {
+		return "TRUE"
+	}
+
+	op, idOp := ">", ">"
+	if f.SortDirection() == "DESC" {
+		op = "<"
+	}
+	if c.Prev {
+		op, idOp = flip(op), flip(idOp)
+	}
+
+	return fmt.Sprintf("(%s %s $%d OR (%s = $%d AND id %s $%d))", col, op, valueArg, col, valueArg, idOp, idArg)
+}
+
+// KeysetArgs returns the values for the placeholders used by KeysetCondition(), or nil
+// if there is no cursor.
+func (f Filter) KeysetArgs() []any {
+	c, ok := f.cursor()
+	if !ok {
+		return nil
+	}
+	return []any{c.Value, c.ID}
+}
+
+// KeysetOrderBy returns the ORDER BY clause for a keyset page. A previous page is
+// fetched in reverse order, starting from the cursor and walking backwards, and the
+// caller must reverse the rows again before returning them. col is the same sort
+// expression that was passed to KeysetCondition().
+func (f Filter) KeysetOrderBy(col string) string {
+	dir, idDir := f.SortDirection(), "ASC"
+	if f.Backward() {
+		dir, idDir = flipDirection(dir), flipDirection(idDir)
+	}
+	return fmt.Sprintf("%s %s, id %s", col, dir, idDir)
+}
+
+// Backward reports whether the filter is fetching the page before a cursor.
+func (f Filter) Backward() bool {
+	c, ok := f.cursor()
+	return ok && c.Prev
+}
+
+func (f Filter) cursor() (Cursor, bool) {
+	if !f.UseCursor || f.Cursor == "" {
+		return Cursor{}, false
+	}
+	c, err := DecodeCursor(f.Cursor)
+	if err != nil {
+		return Cursor{}, false
+	}
+	return c, true
+}
+
+func flip(op string) string {
+	if op == ">" {
+		return "<"
+	}
+	return ">"
+}
+
+func flipDirection(dir string) string {
+	if dir == "ASC" {
+		return "DESC"
+	}
+	return "ASC"
+}
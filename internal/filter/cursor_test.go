@@ -0,0 +1,226 @@
+package filter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursors := []Cursor{
+		{Sort: "id", Value: "42", ID: 42},
+		{Sort: "-title", Value: "Amélie, \"the\" film", ID: 7, Prev: true},
+		{Sort: "-rank", Value: "0.0607927", ID: 1},
+	}
+
+	for _, c := range cursors {
+		got, err := DecodeCursor(EncodeCursor(c))
+		if err != nil {
+			t.Fatalf("DecodeCursor(EncodeCursor(%+v)): %v", c, err)
+		}
+		if !reflect.DeepEqual(got, c) {
+			t.Errorf("round trip of %+v gave %+v", c, got)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "!!!"},
+		{"padded base64", EncodeCursor(Cursor{Sort: "id", ID: 1}) + "="},
+		{"not json", "bm90IGpzb24"},
+		{"no id", EncodeCursor(Cursor{Sort: "id", Value: "1"})},
+		{"negative id", EncodeCursor(Cursor{Sort: "id", Value: "1", ID: -1})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeCursor(tt.cursor)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodeCursor(%q) error = %v; want ErrInvalidCursor", tt.cursor, err)
+			}
+		})
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	safe := []string{"id", "title", "-id", "-title"}
+	cursor := func(sort string, prev bool) string {
+		return EncodeCursor(Cursor{Sort: sort, Value: "x", ID: 5, Prev: prev})
+	}
+
+	tests := []struct {
+		name      string
+		filter    Filter
+		condition string
+		orderBy   string
+		args      []any
+	}{
+		{
+			name:      "first page",
+			filter:    Filter{Sort: "title", SortSafeList: safe, UseCursor: true},
+			condition: "TRUE",
+			orderBy:   "title ASC, id ASC",
+		},
+		{
+			name:      "offset pagination ignores the cursor",
+			filter:    Filter{Sort: "title", SortSafeList: safe, Cursor: cursor("title", false)},
+			condition: "TRUE",
+			orderBy:   "title ASC, id ASC",
+		},
+		{
+			name:      "next ascending",
+			filter:    Filter{Sort: "title", SortSafeList: safe, UseCursor: true, Cursor: cursor("title", false)},
+			condition: "(title > $3 OR (title = $3 AND id > $4))",
+			orderBy:   "title ASC, id ASC",
+			args:      []any{"x", int64(5)},
+		},
+		{
+			name:      "next descending",
+			filter:    Filter{Sort: "-title", SortSafeList: safe, UseCursor: true, Cursor: cursor("-title", false)},
+			condition: "(title < $3 OR (title = $3 AND id > $4))",
+			orderBy:   "title DESC, id ASC",
+			args:      []any{"x", int64(5)},
+		},
+		{
+			name:      "previous ascending",
+			filter:    Filter{Sort: "title", SortSafeList: safe, UseCursor: true, Cursor: cursor("title", true)},
+			condition: "(title < $3 OR (title = $3 AND id < $4))",
+			orderBy:   "title DESC, id DESC",
+			args:      []any{"x", int64(5)},
+		},
+		{
+			name:      "previous descending",
+			filter:    Filter{Sort: "-title", SortSafeList: safe, UseCursor: true, Cursor: cursor("-title", true)},
+			condition: "(title > $3 OR (title = $3 AND id < $4))",
+			orderBy:   "title ASC, id DESC",
+			args:      []any{"x", int64(5)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			col := tt.filter.SortColumn()
+			if got := tt.filter.KeysetCondition(col, 3, 4); got != tt.condition {
+				t.Errorf("KeysetCondition = %q; want %q", got, tt.condition)
+			}
+			if got := tt.filter.KeysetOrderBy(col); got != tt.orderBy {
+				t.Errorf("KeysetOrderBy = %q; want %q", got, tt.orderBy)
+			}
+			if got := tt.filter.KeysetArgs(); !reflect.DeepEqual(got, tt.args) {
+				t.Errorf("KeysetArgs = %v; want %v", got, tt.args)
+			}
+		})
+	}
+}
+
+func TestFilterValidateCursor(t *testing.T) {
+	safe := []string{"id", "-id"}
+
+	tests := []struct {
+		name   string
+		cursor string
+		valid  bool
+	}{
+		{"first page", "", true},
+		{"same sort", EncodeCursor(Cursor{Sort: "-id", Value: "9", ID: 9}), true},
+		{"other sort", EncodeCursor(Cursor{Sort: "id", Value: "9", ID: 9}), false},
+		{"garbage", "garbage", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filter{PageSize: 20, Sort: "-id", SortSafeList: safe, UseCursor: true, Cursor: tt.cursor}
+			v := validator.New()
+			f.Validate(v)
+			if v.Valid() != tt.valid {
+				t.Errorf("Validate: valid = %t, errors %v; want valid = %t", v.Valid(), v.Errors, tt.valid)
+			}
+		})
+	}
+}
+
+func TestMovieFilterValidateCursorValue(t *testing.T) {
+	safe := []string{"id", "title", "year", "rating", "-id", "-title", "-year", "-rating"}
+
+	tests := []struct {
+		sort  string
+		value string
+		valid bool
+	}{
+		{"id", "42", true},
+		{"id", "abc", false},
+		{"-year", "1994", true},
+		{"-year", "1994.5", false},
+		{"year", "99999999999", false},
+		{"rating", "7.25", true},
+		{"-rating", "high", false},
+		{"rating", "0x1p-2", false},
+		{"title", "anything at all", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort+" "+tt.value, func(t *testing.T) {
+			f := MovieFilter{Filter: Filter{
+				PageSize:     20,
+				Sort:         tt.sort,
+				SortSafeList: safe,
+				UseCursor:    true,
+				Cursor:       EncodeCursor(Cursor{Sort: tt.sort, Value: tt.value, ID: 1}),
+			}}
+			v := validator.New()
+			f.Validate(v)
+			if v.Valid() != tt.valid {
+				t.Errorf("Validate: valid = %t, errors %v; want valid = %t", v.Valid(), v.Errors, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCalculateCursorMetadata(t *testing.T) {
+	safe := []string{"id"}
+	first := &Cursor{Sort: "id", Value: "1", ID: 1}
+	last := &Cursor{Sort: "id", Value: "3", ID: 3}
+	from := EncodeCursor(Cursor{Sort: "id", Value: "4", ID: 4, Prev: true})
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		more     bool
+		wantNext bool
+		wantPrev bool
+	}{
+		{"only page", Filter{SortSafeList: safe, Sort: "id", UseCursor: true}, false, false, false},
+		{"first of several", Filter{SortSafeList: safe, Sort: "id", UseCursor: true}, true, true, false},
+		{"backward to the first", Filter{SortSafeList: safe, Sort: "id", UseCursor: true, Cursor: from}, false, true, false},
+		{"backward to the middle", Filter{SortSafeList: safe, Sort: "id", UseCursor: true, Cursor: from}, true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := CalculateCursorMetadata(tt.filter, first, last, tt.more)
+			if (m.NextCursor != "") != tt.wantNext || (m.PrevCursor != "") != tt.wantPrev {
+				t.Fatalf("next = %q, prev = %q; want next %t, prev %t", m.NextCursor, m.PrevCursor, tt.wantNext, tt.wantPrev)
+			}
+			if tt.wantNext {
+				if c, _ := DecodeCursor(m.NextCursor); c.ID != last.ID || c.Prev {
+					t.Errorf("next cursor = %+v; want forwards from %+v", c, *last)
+				}
+			}
+			if tt.wantPrev {
+				if c, _ := DecodeCursor(m.PrevCursor); c.ID != first.ID || !c.Prev {
+					t.Errorf("prev cursor = %+v; want backwards from %+v", c, *first)
+				}
+			}
+		})
+	}
+
+	if m := CalculateCursorMetadata(Filter{PageSize: 20}, nil, nil, false); m != (Metadata{PageSize: 20}) {
+		t.Errorf("empty page metadata = %+v; want only the page size", m)
+	}
+}
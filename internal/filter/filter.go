@@ -6,22 +6,40 @@ import (
 	"github.com/rwx-yxu/greenlight/internal/validator"
 )
 
+// Filter holds the pagination and sort parameters for a list. By default lists are
+// paginated by page number using OFFSET. If UseCursor is set the list is paginated by
+// keyset instead: Cursor is empty for the first page and otherwise holds a cursor
+// returned in the Metadata of a previous page, and Page is ignored.
 type Filter struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	Cursor       string
+	UseCursor    bool
 }
 
 func (f Filter) Validate(v *validator.Validator) {
 	// Check that the page and page_size parameters contain sensible values.
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	if !f.UseCursor {
+		v.Check(f.Page > 0, "page", "must be greater than zero")
+		v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	}
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
 	// Check that the sort parameter matches a value in the safelist.
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+
+	// Check that the cursor was issued by us and for the same sort order.
+	if f.UseCursor && f.Cursor != "" {
+		c, err := DecodeCursor(f.Cursor)
+		if err != nil {
+			v.AddError("cursor", "must be a cursor returned by a previous request")
+			return
+		}
+		v.Check(c.Sort == f.Sort, "cursor", "must be used with the same sort it was issued for")
+	}
 }
 
 // Check that the client-provided Sort field matches one of the entries in our safelist
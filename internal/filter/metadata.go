@@ -4,11 +4,13 @@ import "math"
 
 // Define a new Metadata struct for holding the pagination metadata.
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 // The calculateMetadata() function calculates the appropriate pagination metadata
@@ -30,3 +32,34 @@ func CalculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// CalculateCursorMetadata returns the metadata for a keyset paginated page. first and
+// last are the cursors of the first and last records on the page, and more reports
+// whether the query found records beyond the page in the direction it was reading.
+func CalculateCursorMetadata(f Filter, first, last *Cursor, more bool) Metadata {
+	metadata := Metadata{PageSize: f.PageSize}
+	if first == nil || last == nil {
+		return metadata
+	}
+
+	// Reading forwards there is a next page if the query found more records, and a
+	// previous page if we started from a cursor. Reading backwards it's the other way
+	// around, and there is always a next page because that's where we came from.
+	hasNext, hasPrev := more, f.Cursor != ""
+	if f.Backward() {
+		hasNext, hasPrev = true, more
+	}
+
+	if hasNext {
+		next := *last
+		next.Prev = false
+		metadata.NextCursor = EncodeCursor(next)
+	}
+	if hasPrev {
+		prev := *first
+		prev.Prev = true
+		metadata.PrevCursor = EncodeCursor(prev)
+	}
+
+	return metadata
+}
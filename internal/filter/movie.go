@@ -0,0 +1,125 @@
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// MovieFilter holds every parameter accepted by the movie list. A zero value for any
+// of the range bounds, or an empty genre list, means that bound or list isn't applied.
+type MovieFilter struct {
+	Title         string
+	Q             string   // ranked prefix and phrase search on the title, see TSQuery()
+	Genres        []string // movies must have every one of these genres
+	GenresAny     []string // movies must have at least one of these genres
+	ExcludeGenres []string // movies must have none of these genres
+	YearMin       int
+	YearMax       int
+	RuntimeMin    int
+	RuntimeMax    int
+	PersonID      int64 // movies must credit this person in any role
+	CollectionID  int64 // movies must belong to this collection
+	Filter
+}
+
+func (f MovieFilter) Validate(v *validator.Validator) {
+	for key, genres := range map[string][]string{
+		"genres":         f.Genres,
+		"genres_any":     f.GenresAny,
+		"exclude_genres": f.ExcludeGenres,
+	} {
+		v.Check(len(genres) <= 20, key, "must not contain more than 20 genres")
+		v.Check(validator.Unique(genres), key, "must not contain duplicate values")
+	}
+
+	maxYear := time.Now().Year()
+	if f.YearMin != 0 {
+		v.Check(f.YearMin >= 1888, "year_min", "must be greater than 1888")
+		v.Check(f.YearMin <= maxYear, "year_min", "must not be in the future")
+	}
+	if f.YearMax != 0 {
+		v.Check(f.YearMax >= 1888, "year_max", "must be greater than 1888")
+		v.Check(f.YearMax <= maxYear, "year_max", "must not be in the future")
+	}
+	if f.YearMin != 0 && f.YearMax != 0 {
+		v.Check(f.YearMax >= f.YearMin, "year_max", "must not be less than year_min")
+	}
+
+	v.Check(f.RuntimeMin >= 0, "runtime_min", "must be a positive integer")
+	v.Check(f.RuntimeMax >= 0, "runtime_max", "must be a positive integer")
+	if f.RuntimeMin != 0 && f.RuntimeMax != 0 {
+		v.Check(f.RuntimeMax >= f.RuntimeMin, "runtime_max", "must not be less than runtime_min")
+	}
+
+	v.Check(f.PersonID >= 0, "person", "must be a positive integer")
+	v.Check(f.CollectionID >= 0, "collection", "must be a positive integer")
+
+	v.Check(len(f.Q) <= 200, "q", "must not be more than 200 bytes long")
+	if f.Q != "" {
+		v.Check(f.TSQuery() != "", "q", "must contain at least one letter or digit")
+	}
+	if strings.TrimPrefix(f.Sort, "-") == "rank" {
+		v.Check(f.Q != "", "sort", "rank can only be used with q")
+	}
+
+	f.Filter.Validate(v)
+
+	// The cursor value is bound to a query parameter compared against the sort
+	// column, so a forged value of the wrong type would only be rejected by Postgres.
+	if c, ok := f.cursor(); ok && validator.PermittedValue(f.Sort, f.SortSafeList...) {
+		v.Check(validCursorValue(f.SortColumn(), c.Value), "cursor", "must be a cursor returned by a previous request")
+	}
+}
+
+// validCursorValue reports whether value is a valid value of the movie sort column
+// col, in the form movieCursor in the movie broker writes it.
+func validCursorValue(col, value string) bool {
+	switch col {
+	case "id":
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case "year", "runtime":
+		_, err := strconv.ParseInt(value, 10, 32)
+		return err == nil
+	case "rank", "rating":
+		// ParseFloat also accepts hexadecimal and underscored numbers, which Postgres
+		// doesn't.
+		_, err := strconv.ParseFloat(value, 32)
+		return err == nil && !strings.ContainsAny(value, "xX_")
+	default:
+		return true
+	}
+}
+
+// TSQuery converts the q parameter into a to_tsquery() expression. Words inside double
+// quotes must appear next to each other in that order, and every other word matches
+// as a prefix, so `star wa` finds "Star Wars" while the user is still typing. Every
+// part has to match. Anything that isn't a letter or a digit is treated as a word
+// separator, which also stops clients from injecting tsquery operators of their own.
+func (f MovieFilter) TSQuery() string {
+	var parts []string
+
+	for i, segment := range strings.Split(f.Q, `"`) {
+		words := strings.FieldsFunc(strings.ToLower(segment), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(words) == 0 {
+			continue
+		}
+
+		// Splitting on quotes puts every quoted phrase at an odd index.
+		if i%2 == 1 {
+			parts = append(parts, "("+strings.Join(words, " <-> ")+")")
+			continue
+		}
+		for _, word := range words {
+			parts = append(parts, word+":*")
+		}
+	}
+
+	return strings.Join(parts, " & ")
+}
@@ -0,0 +1,134 @@
+// Package imdb reads the title.basics dataset that IMDb publishes as a gzipped,
+// tab separated dump at https://datasets.imdbws.com.
+package imdb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+// null is how the dumps write a missing value.
+const null = `\N`
+
+// maxLineBytes is the longest row we accept. Real rows are well under 1KB.
+const maxLineBytes = 64 << 10
+
+var ErrInvalidHeader = errors.New("imdb: not a title.basics file")
+
+// basicsColumns are the columns of title.basics that are mapped onto a movie.
+var basicsColumns = []string{"tconst", "titleType", "primaryTitle", "isAdult", "startYear", "runtimeMinutes", "genres"}
+
+// A BasicsReader returns the titles of a title.basics dump one at a time, so that a
+// dump of several million rows is never held in memory.
+type BasicsReader struct {
+	scanner *bufio.Scanner
+	columns map[string]int
+	types   map[string]bool
+
+	// Line is the line number of the row last read, counting the header as line 1.
+	Line int
+}
+
+// NewBasicsReader reads the header of a title.basics dump, which may be gzipped or
+// not. Only titles of the given types are returned, such as "movie" or "tvMovie", and
+// adult titles are always left out.
+func NewBasicsReader(r io.Reader, types ...string) (*BasicsReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	var src io.Reader = br
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		src, err = gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b := &BasicsReader{
+		scanner: bufio.NewScanner(src),
+		columns: map[string]int{},
+		types:   map[string]bool{},
+	}
+	b.scanner.Buffer(make([]byte, 0, 4096), maxLineBytes)
+	for _, t := range types {
+		b.types[t] = true
+	}
+
+	if !b.scanner.Scan() {
+		if err := b.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidHeader
+	}
+	b.Line++
+	for i, name := range strings.Split(b.scanner.Text(), "\t") {
+		b.columns[name] = i
+	}
+	for _, name := range basicsColumns {
+		if _, ok := b.columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing %s column", ErrInvalidHeader, name)
+		}
+	}
+
+	return b, nil
+}
+
+// SkipTo reads past every line up to and including the given line without parsing
+// them, so that an import can carry on after the last line it committed.
+func (b *BasicsReader) SkipTo(line int) error {
+	for b.Line < line && b.scanner.Scan() {
+		b.Line++
+	}
+	return b.scanner.Err()
+}
+
+// Next returns the next title of a wanted type as a movie, or io.EOF once there are
+// none left. The movie isn't validated. A missing or malformed year or runtime is left
+// as 0, so that validation reports the row as invalid rather than reading stopping.
+// The tconst is set as the movie's IMDb id.
+func (b *BasicsReader) Next() (*models.Movie, error) {
+	for b.scanner.Scan() {
+		b.Line++
+		fields := strings.Split(b.scanner.Text(), "\t")
+		if len(fields) != len(b.columns) {
+			return nil, fmt.Errorf("imdb: line %d: has %d fields, expected %d", b.Line, len(fields), len(b.columns))
+		}
+		field := func(name string) string {
+			return fields[b.columns[name]]
+		}
+
+		if !b.types[field("titleType")] || field("isAdult") == "1" {
+			continue
+		}
+
+		movie := &models.Movie{
+			Title:       field("primaryTitle"),
+			Genres:      []string{},
+			ExternalIDs: map[string]string{models.SourceIMDb: field("tconst")},
+		}
+		if year, err := strconv.ParseInt(field("startYear"), 10, 32); err == nil {
+			movie.Year = int32(year)
+		}
+		if runtime, err := strconv.ParseInt(field("runtimeMinutes"), 10, 32); err == nil {
+			movie.Runtime = models.Runtime(runtime)
+		}
+		if genres := field("genres"); genres != null && genres != "" {
+			movie.Genres = strings.Split(genres, ",")
+		}
+		return movie, nil
+	}
+	if err := b.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,198 @@
+package imdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rwx-yxu/greenlight/internal/models"
+)
+
+const basicsHeader = "tconst\ttitleType\tprimaryTitle\toriginalTitle\tisAdult\tstartYear\tendYear\truntimeMinutes\tgenres\n"
+
+// readAll returns every movie a BasicsReader returns for the given dump.
+func readAll(t *testing.T, r io.Reader, types ...string) []*models.Movie {
+	t.Helper()
+	b, err := NewBasicsReader(r, types...)
+	if err != nil {
+		t.Fatalf("NewBasicsReader: %v", err)
+	}
+	var movies []*models.Movie
+	for {
+		movie, err := b.Next()
+		if errors.Is(err, io.EOF) {
+			return movies
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		movies = append(movies, movie)
+	}
+}
+
+func TestBasicsReaderNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		row   string
+		types []string
+		want  *models.Movie
+	}{
+		{
+			name: "movie",
+			row:  "tt0111161\tmovie\tThe Shawshank Redemption\tThe Shawshank Redemption\t0\t1994\t\\N\t142\tDrama",
+			want: &models.Movie{
+				Title:       "The Shawshank Redemption",
+				Year:        1994,
+				Runtime:     142,
+				Genres:      []string{"Drama"},
+				ExternalIDs: map[string]string{models.SourceIMDb: "tt0111161"},
+			},
+		},
+		{
+			name: "several genres",
+			row:  "tt0062622\tmovie\t2001: A Space Odyssey\t2001: A Space Odyssey\t0\t1968\t\\N\t149\tAdventure,Sci-Fi",
+			want: &models.Movie{
+				Title:       "2001: A Space Odyssey",
+				Year:        1968,
+				Runtime:     149,
+				Genres:      []string{"Adventure", "Sci-Fi"},
+				ExternalIDs: map[string]string{models.SourceIMDb: "tt0062622"},
+			},
+		},
+		{
+			name: "quotes are kept",
+			row:  "tt0000003\tmovie\tThe \"Quoted\" Title\tX\t0\t2000\t\\N\t90\tDrama",
+			want: &models.Movie{
+				Title:       `The "Quoted" Title`,
+				Year:        2000,
+				Runtime:     90,
+				Genres:      []string{"Drama"},
+				ExternalIDs: map[string]string{models.SourceIMDb: "tt0000003"},
+			},
+		},
+		{
+			name: "null values",
+			row:  "tt0000004\tmovie\tUnknown\tUnknown\t0\t\\N\t\\N\t\\N\t\\N",
+			want: &models.Movie{
+				Title:       "Unknown",
+				Genres:      []string{},
+				ExternalIDs: map[string]string{models.SourceIMDb: "tt0000004"},
+			},
+		},
+		{
+			name: "malformed runtime",
+			row:  "tt0000005\tmovie\tLong\tLong\t0\t2001\t\\N\t1h30\tDrama",
+			want: &models.Movie{
+				Title:       "Long",
+				Year:        2001,
+				Genres:      []string{"Drama"},
+				ExternalIDs: map[string]string{models.SourceIMDb: "tt0000005"},
+			},
+		},
+		{
+			name: "other type",
+			row:  "tt0000001\tshort\tCarmencita\tCarmencita\t0\t1894\t\\N\t1\tDocumentary,Short",
+		},
+		{
+			name:  "wanted type",
+			row:   "tt0000006\ttvMovie\tSpecial\tSpecial\t0\t2010\t\\N\t60\tComedy",
+			types: []string{"movie", "tvMovie"},
+			want: &models.Movie{
+				Title:       "Special",
+				Year:        2010,
+				Runtime:     60,
+				Genres:      []string{"Comedy"},
+				ExternalIDs: map[string]string{models.SourceIMDb: "tt0000006"},
+			},
+		},
+		{
+			name: "adult",
+			row:  "tt0000007\tmovie\tAdult\tAdult\t1\t2010\t\\N\t80\tAdult",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types := tt.types
+			if types == nil {
+				types = []string{"movie"}
+			}
+			movies := readAll(t, strings.NewReader(basicsHeader+tt.row+"\n"), types...)
+			switch {
+			case tt.want == nil && len(movies) != 0:
+				t.Errorf("got %+v; want no movies", *movies[0])
+			case tt.want != nil && len(movies) != 1:
+				t.Errorf("got %d movies; want 1", len(movies))
+			case tt.want != nil && !reflect.DeepEqual(movies[0], tt.want):
+				t.Errorf("got %+v; want %+v", *movies[0], *tt.want)
+			}
+		})
+	}
+}
+
+func TestBasicsReaderGzip(t *testing.T) {
+	dump := basicsHeader +
+		"tt0000001\tshort\tCarmencita\tCarmencita\t0\t1894\t\\N\t1\tDocumentary,Short\n" +
+		"tt0111161\tmovie\tThe Shawshank Redemption\tThe Shawshank Redemption\t0\t1994\t\\N\t142\tDrama\n"
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	if _, err := w.Write([]byte(dump)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := readAll(t, strings.NewReader(dump), "movie")
+	zipped := readAll(t, &gz, "movie")
+	if len(plain) != 1 || !reflect.DeepEqual(plain, zipped) {
+		t.Errorf("gzipped dump read as %+v; want %+v", zipped, plain)
+	}
+}
+
+func TestBasicsReaderSkipTo(t *testing.T) {
+	dump := basicsHeader +
+		"tt0000001\tmovie\tFirst\tFirst\t0\t2001\t\\N\t90\tDrama\n" +
+		"tt0000002\tmovie\tSecond\tSecond\t0\t2002\t\\N\t90\tDrama\n" +
+		"tt0000003\tmovie\tThird\tThird\t0\t2003\t\\N\t90\tDrama\n"
+
+	b, err := NewBasicsReader(strings.NewReader(dump), "movie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SkipTo(3); err != nil {
+		t.Fatal(err)
+	}
+	movie, err := b.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Title != "Third" || b.Line != 4 {
+		t.Errorf("got %q at line %d; want %q at line 4", movie.Title, b.Line, "Third")
+	}
+}
+
+func TestBasicsReaderInvalid(t *testing.T) {
+	_, err := NewBasicsReader(strings.NewReader("tconst\ttitleType\n"), "movie")
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("missing columns: got %v; want ErrInvalidHeader", err)
+	}
+
+	_, err = NewBasicsReader(strings.NewReader(""), "movie")
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("empty file: got %v; want ErrInvalidHeader", err)
+	}
+
+	b, err := NewBasicsReader(strings.NewReader(basicsHeader+"tt0000001\tmovie\tShort row\n"), "movie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Next(); err == nil || errors.Is(err, io.EOF) {
+		t.Errorf("short row: got %v; want an error", err)
+	}
+}
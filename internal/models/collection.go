@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+const (
+	// CollectionRelease orders a collection's movies by year, falling back to the
+	// custom order for movies released in the same year.
+	CollectionRelease = "release"
+	CollectionCustom  = "custom"
+)
+
+// A Collection groups related movies, such as the films of a series. A movie belongs
+// to at most one collection. Movies is only filled in when a single collection is
+// read.
+type Collection struct {
+	ID          int64              `json:"id"`
+	CreatedAt   time.Time          `json:"-"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Ordering    string             `json:"ordering"`
+	MovieCount  int                `json:"movie_count"`
+	Version     int32              `json:"version"`
+	Movies      []*CollectionEntry `json:"movies,omitempty"`
+}
+
+// A CollectionEntry is a movie in a collection, at a position counting from 1 in the
+// collection's order.
+type CollectionEntry struct {
+	Position int    `json:"position"`
+	MovieID  int64  `json:"movie_id"`
+	Title    string `json:"title"`
+	Year     int32  `json:"year"`
+}
+
+// A MovieCollection is the collection block shown with a movie, giving the movie's
+// place in its collection and the entries either side of it.
+type MovieCollection struct {
+	ID       int64            `json:"id"`
+	Name     string           `json:"name"`
+	Position int              `json:"position"`
+	Total    int              `json:"total"`
+	Previous *CollectionEntry `json:"previous,omitempty"`
+	Next     *CollectionEntry `json:"next,omitempty"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The systems whose identifiers can be recorded against a movie.
+const (
+	SourceIMDb     = "imdb"
+	SourceTMDb     = "tmdb"
+	SourceWikidata = "wikidata"
+)
+
+// An ExternalID is one identifier of a movie in another system.
+type ExternalID struct {
+	Source string
+	ID     string
+}
+
+// ExternalIDRX holds the pattern a valid identifier from each source matches, such as
+// tt0111161 for IMDb, 278 for TMDb and Q172241 for Wikidata.
+var ExternalIDRX = map[string]*regexp.Regexp{
+	SourceIMDb:     regexp.MustCompile(`^tt[0-9]{7,10}$`),
+	SourceTMDb:     regexp.MustCompile(`^[1-9][0-9]{0,9}$`),
+	SourceWikidata: regexp.MustCompile(`^Q[1-9][0-9]*$`),
+}
+
+// NormaliseExternalID puts an identifier into the form it is stored in, so that
+// "TT0111161" and "tt0111161" are the same IMDb id.
+func NormaliseExternalID(source, id string) string {
+	id = strings.TrimSpace(id)
+	switch source {
+	case SourceIMDb:
+		return strings.ToLower(id)
+	case SourceWikidata:
+		return strings.ToUpper(id)
+	default:
+		return id
+	}
+}
+
+// NormaliseExternalIDs normalises every id in a map of ids keyed by source, in place.
+func NormaliseExternalIDs(ids map[string]string) {
+	for source, id := range ids {
+		ids[source] = NormaliseExternalID(source, id)
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A Genre is one of the canonical genres movies are filed under. Movies refer to a
+// genre by its slug, and Aliases holds the other names, also in slug form, which are
+// accepted for it. Movies is the number of movies with the genre, and is only filled
+// in when every genre is read.
+type Genre struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Aliases   []string  `json:"aliases"`
+	Movies    int64     `json:"movies"`
+}
+
+var genreSlugRX = regexp.MustCompile(`[^a-z0-9]+`)
+
+// GenreSlug returns the slug form of a genre name, so that "Sci-Fi", "sci fi" and
+// "SCI_FI" are all "sci-fi". The genres migration normalises names in the same way.
+func GenreSlug(name string) string {
+	return strings.Trim(genreSlugRX.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
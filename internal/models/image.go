@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+const (
+	ImagePoster   = "poster"
+	ImageBackdrop = "backdrop"
+
+	// ImageOriginal is the variant holding the image exactly as it was uploaded.
+	ImageOriginal = "original"
+)
+
+// An Image is a movie's poster or backdrop. A movie has at most one of each, and
+// uploading a new one replaces it under a new ID, so the files of an image never
+// change. URLs maps each variant to the address it is served from, which is based on
+// the image's random Token rather than its ID so that it can't be guessed.
+type Image struct {
+	ID          int64             `json:"id"`
+	Token       string            `json:"-"`
+	CreatedAt   time.Time         `json:"created_at"`
+	MovieID     int64             `json:"movie_id"`
+	Kind        string            `json:"kind"`
+	ContentType string            `json:"content_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	URLs        map[string]string `json:"urls,omitempty"`
+}
+
+// An ImageVariant is a resized JPEG copy of an image, which is scaled down to Width
+// while keeping its aspect ratio. Images narrower than Width are not scaled up.
+type ImageVariant struct {
+	Name  string
+	Width int
+}
+
+// ImageVariants lists the resized copies made of each kind of image.
+var ImageVariants = map[string][]ImageVariant{
+	ImagePoster: {
+		{Name: "small", Width: 185},
+		{Name: "medium", Width: 342},
+		{Name: "large", Width: 780},
+	},
+	ImageBackdrop: {
+		{Name: "small", Width: 300},
+		{Name: "medium", Width: 780},
+		{Name: "large", Width: 1280},
+	},
+}
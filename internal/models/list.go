@@ -0,0 +1,45 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+)
+
+// WatchlistName is the name of the list every user has for the movies they want to
+// watch. It is created the first time the user's lists are read.
+const WatchlistName = "Watchlist"
+
+// A List is a user's ordered collection of movies. A public list can be read by anyone
+// who knows its slug. Items is only filled in when a single list is read.
+type List struct {
+	ID        int64       `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	UserID    int64       `json:"user_id"`
+	Name      string      `json:"name"`
+	Watchlist bool        `json:"watchlist"`
+	Public    bool        `json:"public"`
+	Slug      string      `json:"slug,omitempty"`
+	ItemCount int         `json:"item_count"`
+	Version   int32       `json:"version"`
+	Items     []*ListItem `json:"items,omitempty"`
+}
+
+// A ListItem is a movie on a list, at a position counting from 1.
+type ListItem struct {
+	Position int       `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	Movie    *Movie    `json:"movie"`
+}
+
+// GenerateListSlug returns a random slug for sharing a list. Slugs are long enough
+// that shared lists can't be found by guessing.
+func GenerateListSlug() (string, error) {
+	randomBytes := make([]byte, 10)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)), nil
+}
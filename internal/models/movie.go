@@ -16,6 +16,38 @@ type Movie struct {
 	Runtime   Runtime   `json:"runtime,omitempty"`
 	Genres    []string  `json:"genres,omitempty"`
 	Version   int32     `json:"version"`
+	// OriginalTitle and TitleLanguage are only set when Title has been replaced by the
+	// alternate title best matching the client's preferred languages.
+	OriginalTitle string `json:"original_title,omitempty"`
+	TitleLanguage string `json:"title_language,omitempty"`
+	// Rating is the average score users have given the movie, from 1 to 10, and Votes
+	// the number of users who have rated it. Rating is 0 until someone rates it.
+	Rating float32 `json:"rating"`
+	Votes  int32   `json:"votes"`
+	// Rank and Snippet are only set when listing movies with a search query. Snippet
+	// is the title with every matching term wrapped in <mark> tags.
+	Rank    float32 `json:"rank,omitempty"`
+	Snippet string  `json:"snippet,omitempty"`
+	// DeletedAt is only set for movies in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Credits is only set when a single movie is requested with its credits.
+	Credits []*Credit `json:"credits,omitempty"`
+	// Collection is only set when a single movie in a collection is requested.
+	Collection *MovieCollection `json:"collection,omitempty"`
+	// Titles is only set when a single movie is requested with its alternate titles.
+	Titles []*MovieTitle `json:"titles,omitempty"`
+	// ExternalIDs maps a source such as "imdb" to the movie's identifier there. It is
+	// only set when a single movie is read.
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+}
+
+// A MovieSuggestion is a movie whose title is similar to a possibly misspelt search
+// term. Score is the pg_trgm word similarity between the two, from 0 to 1.
+type MovieSuggestion struct {
+	ID    int64   `json:"id"`
+	Title string  `json:"title"`
+	Year  int32   `json:"year"`
+	Score float32 `json:"score"`
 }
 
 // Declare a custom Runtime type, which has the underlying type int32 (the same as our
@@ -79,3 +111,33 @@ func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 
 	return nil
 }
+
+const (
+	MovieCreate  = "create"
+	MovieUpdate  = "update"
+	MovieDelete  = "delete"
+	MovieRestore = "restore"
+)
+
+// A MovieRevision records one change to a movie: the version the change produced, the
+// user who made it and the movie before and after. Before is nil for a newly created
+// or restored movie, and After is nil for a deleted one.
+type MovieRevision struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	MovieID   int64     `json:"movie_id"`
+	Version   int32     `json:"version"`
+	UserID    *int64    `json:"user_id"`
+	Action    string    `json:"action"`
+	Before    *Movie    `json:"before"`
+	After     *Movie    `json:"after"`
+}
+
+// A Rating is the score from 1 to 10 that a user has given a movie.
+type Rating struct {
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	Score     int16     `json:"score"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Permissions []string
 
 // Add a helper method to check whether the Permissions slice contains a specific
@@ -12,3 +14,21 @@ func (p Permissions) Include(code string) bool {
 	}
 	return false
 }
+
+const (
+	PermissionGrant  = "grant"
+	PermissionRevoke = "revoke"
+)
+
+// A PermissionChange records a single permission code being granted to or revoked
+// from a user, and the user who made the change. Role is the name of the role that was
+// assigned or unassigned, and nil for a direct grant or revoke.
+type PermissionChange struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    int64     `json:"user_id"`
+	ActorID   *int64    `json:"actor_id"`
+	Code      string    `json:"code"`
+	Action    string    `json:"action"`
+	Role      *string   `json:"role,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+const (
+	CreditDirector = "director"
+	CreditWriter   = "writer"
+	CreditActor    = "actor"
+)
+
+// A Person is someone who worked on a movie. Filmography is only filled in when a
+// single person is read.
+type Person struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"-"`
+	Name        string    `json:"name"`
+	Version     int32     `json:"version"`
+	Filmography []*Credit `json:"filmography,omitempty"`
+}
+
+// A Credit records that a person worked on a movie in a given role. Character is only
+// set for actors, and Billing orders the credits of each role, starting from 1 for top
+// billing. A credit listed for a movie carries the person's name, and one listed for a
+// person carries the movie's title and year.
+type Credit struct {
+	ID         int64  `json:"id"`
+	MovieID    int64  `json:"movie_id"`
+	PersonID   int64  `json:"person_id"`
+	Role       string `json:"role"`
+	Character  string `json:"character,omitempty"`
+	Billing    int    `json:"billing,omitempty"`
+	PersonName string `json:"person_name,omitempty"`
+	MovieTitle string `json:"movie_title,omitempty"`
+	MovieYear  int32  `json:"movie_year,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// A Review is a user's written opinion of a movie. New and edited reviews are pending
+// until a moderator approves or rejects them, and only approved reviews are shown to
+// anyone other than their author.
+type Review struct {
+	ID          int64      `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	MovieID     int64      `json:"movie_id"`
+	UserID      int64      `json:"user_id"`
+	Body        string     `json:"body"`
+	Status      string     `json:"status"`
+	ModeratedBy *int64     `json:"moderated_by,omitempty"`
+	ModeratedAt *time.Time `json:"moderated_at,omitempty"`
+	Version     int32      `json:"version"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// A Role is a named bundle of permission codes. Every user assigned to a role is
+// granted all of its permissions in addition to any granted to them directly.
+type Role struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"-"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Permissions Permissions `json:"permissions"`
+	Version     int32       `json:"version"`
+}
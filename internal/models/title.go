@@ -0,0 +1,47 @@
+package models
+
+import "strings"
+
+// A MovieTitle is the title a movie is known by in one language, which may be narrowed
+// to a region as in "pt-BR". SearchConfig is the Postgres text search configuration
+// the title is indexed with.
+type MovieTitle struct {
+	ID           int64  `json:"-"`
+	MovieID      int64  `json:"movie_id"`
+	Language     string `json:"language"`
+	Title        string `json:"title"`
+	SearchConfig string `json:"-"`
+}
+
+// titleSearchConfigs maps a language subtag to the text search configuration which
+// ships with Postgres for that language.
+var titleSearchConfigs = map[string]string{
+	"da": "danish",
+	"de": "german",
+	"en": "english",
+	"es": "spanish",
+	"fi": "finnish",
+	"fr": "french",
+	"hu": "hungarian",
+	"it": "italian",
+	"nb": "norwegian",
+	"nl": "dutch",
+	"nn": "norwegian",
+	"no": "norwegian",
+	"pt": "portuguese",
+	"ro": "romanian",
+	"ru": "russian",
+	"sv": "swedish",
+	"tr": "turkish",
+}
+
+// TitleSearchConfig returns the text search configuration for titles in the given
+// language, falling back to "simple", which doesn't stem words, for languages Postgres
+// has no configuration for.
+func TitleSearchConfig(language string) string {
+	base, _, _ := strings.Cut(strings.ToLower(language), "-")
+	if config, ok := titleSearchConfigs[base]; ok {
+		return config
+	}
+	return "simple"
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache is the interface the cached services use to store lookups. The default
+// implementation is the in-process LRU returned by NewLRUCache, but anything that
+// satisfies this interface can be plugged into the Cached* constructors instead.
+type Cache interface {
+	Get(key string) (any, bool)
+	Set(key string, value any)
+	// SetWithTTL is Set, except that the entry expires after ttl if that is sooner
+	// than the cache's own TTL.
+	SetWithTTL(key string, value any, ttl time.Duration)
+	Delete(key string)
+	// DeleteFunc removes every entry for which match returns true. It is used to
+	// invalidate entries that can't be found by key alone, such as every cached
+	// token lookup for a particular user.
+	DeleteFunc(match func(key string, value any) bool)
+	Stats() CacheStats
+}
+
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+}
+
+type lruEntry struct {
+	key       string
+	value     any
+	expiresAt time.Time
+}
+
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[string]*list.Element
+	order    *list.List
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+// NewLRUCache returns a Cache holding at most capacity entries, each of which expires
+// ttl after it was set. When the cache is full the least recently used entry is
+// evicted to make room.
+func NewLRUCache(capacity int, ttl time.Duration) Cache {
+	return &lruCache{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *lruCache) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.remove(el)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	c.hits.Add(1)
+	return entry.value, true
+}
+
+func (c *lruCache) Set(key string, value any) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+func (c *lruCache) SetWithTTL(key string, value any, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ttl > c.ttl {
+		ttl = c.ttl
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+func (c *lruCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *lruCache) DeleteFunc(match func(key string, value any) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, el := range c.items {
+		if match(key, el.Value.(*lruEntry).value) {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *lruCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := c.order.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+	}
+}
+
+// remove must be called with the mutex held.
+func (c *lruCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*lruEntry).key)
+}
+
+// deletePrefix removes every entry whose key starts with prefix from any Cache.
+func deletePrefix(c Cache, prefix string) {
+	c.DeleteFunc(func(key string, _ any) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheGetSet(t *testing.T) {
+	c := NewLRUCache(10, time.Minute)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("Get on an empty cache found an entry")
+	}
+	c.Set("a", 1)
+	c.Set("a", 2)
+	if v, ok := c.Get("a"); !ok || v != 2 {
+		t.Errorf("Get(a) = %v, %t; want 2, true", v, ok)
+	}
+
+	want := CacheStats{Hits: 1, Misses: 1, Entries: 1}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats = %+v; want %+v", got, want)
+	}
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := NewLRUCache(2, time.Minute)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	// Reading a makes b the least recently used entry.
+	c.Get("a")
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b wasn't evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if got := c.Stats(); got.Evictions != 1 || got.Entries != 2 {
+		t.Errorf("Stats = %+v; want 1 eviction and 2 entries", got)
+	}
+}
+
+func TestLRUCacheExpiry(t *testing.T) {
+	c := NewLRUCache(10, 50*time.Millisecond)
+
+	c.Set("a", 1)
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get found an expired entry")
+	}
+	if got := c.Stats(); got.Entries != 0 || got.Misses != 1 {
+		t.Errorf("Stats = %+v; want the expired entry removed and counted as a miss", got)
+	}
+
+	// Setting an entry again restarts its ttl.
+	c.Set("b", 1)
+	time.Sleep(30 * time.Millisecond)
+	c.Set("b", 2)
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("b"); !ok {
+		t.Error("Set didn't restart the ttl of an existing entry")
+	}
+}
+
+func TestLRUCacheSetWithTTL(t *testing.T) {
+	c := NewLRUCache(10, 50*time.Millisecond)
+
+	c.SetWithTTL("short", 1, 10*time.Millisecond)
+	c.SetWithTTL("long", 2, time.Hour)
+	c.SetWithTTL("expired", 3, -time.Second)
+	if _, ok := c.Get("expired"); ok {
+		t.Error("Get found an entry set with a ttl in the past")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get("short"); ok {
+		t.Error("Get found an entry past its own ttl")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := c.Get("long"); ok {
+		t.Error("Get found an entry past the cache's ttl")
+	}
+}
+
+func TestLRUCacheDelete(t *testing.T) {
+	c := NewLRUCache(10, time.Minute)
+
+	c.Set("user:1", 1)
+	c.Set("user:2", 2)
+	c.Set("permissions:1", 3)
+
+	c.Delete("user:1")
+	c.Delete("missing")
+	if _, ok := c.Get("user:1"); ok {
+		t.Error("Delete left user:1 in the cache")
+	}
+
+	deletePrefix(c, "user:")
+	if _, ok := c.Get("user:2"); ok {
+		t.Error("deletePrefix left user:2 in the cache")
+	}
+
+	c.DeleteFunc(func(key string, value any) bool {
+		return strings.HasPrefix(key, "permissions:") && value == 4
+	})
+	if _, ok := c.Get("permissions:1"); !ok {
+		t.Error("DeleteFunc removed an entry that didn't match")
+	}
+}
+
+func TestLRUCacheConcurrent(t *testing.T) {
+	c := NewLRUCache(50, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := string(rune('a' + (i*j)%100))
+				c.Set(key, j)
+				c.Get(key)
+				if j%100 == 0 {
+					c.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := c.Stats(); got.Entries > 50 {
+		t.Errorf("Stats = %+v; want at most 50 entries", got)
+	}
+}
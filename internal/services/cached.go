@@ -0,0 +1,173 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// The cached services below wrap the plain ones and share a single Cache, because a
+// change made through one service often invalidates entries stored by another. For
+// example deleting a token through the token service has to drop the user lookup
+// cached by the user service.
+//
+// Only authentication tokens are cached. They are the ones looked up on every request
+// by the Authenticate middleware, whereas activation and password reset tokens are
+// used once and then deleted. A cached token lookup never outlives the token's own
+// expiry.
+
+const permissionsKeyPrefix = "permissions:"
+
+func userTokenKey(scope, tokenPlaintext string) string {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	return "user:" + scope + ":" + hex.EncodeToString(hash[:])
+}
+
+func permissionsKey(userID int64) string {
+	return fmt.Sprintf("%s%d", permissionsKeyPrefix, userID)
+}
+
+// deleteUserTokens drops every cached token lookup which resolved to the given user.
+func deleteUserTokens(c Cache, userID int64) {
+	c.DeleteFunc(func(_ string, value any) bool {
+		u, ok := value.(models.User)
+		return ok && u.ID == userID
+	})
+}
+
+type cachedUser struct {
+	UserReadWriter
+	cache Cache
+}
+
+func NewCachedUser(u UserReadWriter, c Cache) UserReadWriter {
+	return &cachedUser{UserReadWriter: u, cache: c}
+}
+
+func (u cachedUser) FindByToken(scope, tokenPlainText string) (*models.User, error) {
+	if scope != models.ScopeAuthentication {
+		return u.UserReadWriter.FindByToken(scope, tokenPlainText)
+	}
+
+	key := userTokenKey(scope, tokenPlainText)
+	// The cache stores a copy of the user rather than the pointer so that a handler
+	// modifying the user it was given can't change what later requests see.
+	if value, ok := u.cache.Get(key); ok {
+		user := value.(models.User)
+		return &user, nil
+	}
+
+	user, expiry, err := u.UserReadWriter.FindByTokenWithExpiry(scope, tokenPlainText)
+	if err != nil {
+		return nil, err
+	}
+	u.cache.SetWithTTL(key, *user, time.Until(expiry))
+	return user, nil
+}
+
+func (u cachedUser) Edit(user *models.User) (*validator.Validator, error) {
+	v, err := u.UserReadWriter.Edit(user)
+	deleteUserTokens(u.cache, user.ID)
+	return v, err
+}
+
+type cachedToken struct {
+	TokenWriteDeleter
+	cache Cache
+}
+
+func NewCachedToken(t TokenWriteDeleter, c Cache) TokenWriteDeleter {
+	return &cachedToken{TokenWriteDeleter: t, cache: c}
+}
+
+func (t cachedToken) Remove(scope, tokenPlaintext string) error {
+	err := t.TokenWriteDeleter.Remove(scope, tokenPlaintext)
+	t.cache.Delete(userTokenKey(scope, tokenPlaintext))
+	return err
+}
+
+func (t cachedToken) RemoveAllForUser(scope string, userID int64) error {
+	err := t.TokenWriteDeleter.RemoveAllForUser(scope, userID)
+	deleteUserTokens(t.cache, userID)
+	return err
+}
+
+type cachedPermission struct {
+	PermissionReadWriter
+	cache Cache
+}
+
+func NewCachedPermission(p PermissionReadWriter, c Cache) PermissionReadWriter {
+	return &cachedPermission{PermissionReadWriter: p, cache: c}
+}
+
+func (p cachedPermission) FindAllForUser(userID int64) (models.Permissions, error) {
+	key := permissionsKey(userID)
+	if value, ok := p.cache.Get(key); ok {
+		return value.(models.Permissions), nil
+	}
+
+	perms, err := p.PermissionReadWriter.FindAllForUser(userID)
+	if err != nil {
+		return models.Permissions{}, err
+	}
+	p.cache.Set(key, perms)
+	return perms, nil
+}
+
+func (p cachedPermission) AddForUser(userID int64, codes ...string) error {
+	err := p.PermissionReadWriter.AddForUser(userID, codes...)
+	p.cache.Delete(permissionsKey(userID))
+	return err
+}
+
+func (p cachedPermission) GrantForUser(actorID, userID int64, codes ...string) error {
+	err := p.PermissionReadWriter.GrantForUser(actorID, userID, codes...)
+	p.cache.Delete(permissionsKey(userID))
+	return err
+}
+
+func (p cachedPermission) RevokeForUser(actorID, userID int64, codes ...string) error {
+	err := p.PermissionReadWriter.RevokeForUser(actorID, userID, codes...)
+	p.cache.Delete(permissionsKey(userID))
+	return err
+}
+
+type cachedRole struct {
+	RoleReadWriteDeleter
+	cache Cache
+}
+
+func NewCachedRole(r RoleReadWriteDeleter, c Cache) RoleReadWriteDeleter {
+	return &cachedRole{RoleReadWriteDeleter: r, cache: c}
+}
+
+// Editing or deleting a role changes the permissions of every user assigned to it, so
+// rather than looking those users up we drop every cached permissions entry.
+func (r cachedRole) Edit(actorID int64, role *models.Role) (*validator.Validator, error) {
+	v, err := r.RoleReadWriteDeleter.Edit(actorID, role)
+	deletePrefix(r.cache, permissionsKeyPrefix)
+	return v, err
+}
+
+func (r cachedRole) RemoveByID(actorID, id int64) error {
+	err := r.RoleReadWriteDeleter.RemoveByID(actorID, id)
+	deletePrefix(r.cache, permissionsKeyPrefix)
+	return err
+}
+
+func (r cachedRole) AddForUser(actorID, roleID, userID int64) error {
+	err := r.RoleReadWriteDeleter.AddForUser(actorID, roleID, userID)
+	r.cache.Delete(permissionsKey(userID))
+	return err
+}
+
+func (r cachedRole) RemoveForUser(actorID, roleID, userID int64) error {
+	err := r.RoleReadWriteDeleter.RemoveForUser(actorID, roleID, userID)
+	r.cache.Delete(permissionsKey(userID))
+	return err
+}
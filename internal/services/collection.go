@@ -0,0 +1,144 @@
+package services
+
+import (
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/filter"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+type collection struct {
+	Broker brokers.CollectionReadWriteDeleter
+}
+
+type CollectionValidator interface {
+	Validate(input models.Collection) validator.Validator
+}
+
+type CollectionReader interface {
+	FindByID(id int64) (*models.Collection, error)
+	FindAll(f filter.Filter) ([]*models.Collection, filter.Metadata, error)
+	FindForMovie(movieID int64) (*models.MovieCollection, error)
+}
+
+type CollectionWriter interface {
+	Add(c *models.Collection) (*validator.Validator, error)
+	Edit(c *models.Collection) (*validator.Validator, error)
+	AddMovie(collectionID, movieID int64) error
+	ReorderMovies(collectionID int64, movieIDs []int64) (*validator.Validator, error)
+}
+
+type CollectionDeleter interface {
+	RemoveByID(id int64) error
+	RemoveMovie(collectionID, movieID int64) error
+}
+
+type CollectionReadWriteDeleter interface {
+	CollectionValidator
+	CollectionReader
+	CollectionWriter
+	CollectionDeleter
+}
+
+func NewCollection(b brokers.CollectionReadWriteDeleter) CollectionReadWriteDeleter {
+	return &collection{
+		Broker: b,
+	}
+}
+
+func (collection) Validate(input models.Collection) validator.Validator {
+	v := validator.New()
+
+	v.Check(input.Name != "", "name", "must be provided")
+	v.Check(len(input.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(input.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+	v.Check(validator.PermittedValue(input.Ordering, models.CollectionRelease, models.CollectionCustom),
+		"ordering", "must be release or custom")
+	return *v
+}
+
+func (c collection) FindByID(id int64) (*models.Collection, error) {
+	col, err := c.Broker.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return col, nil
+}
+
+func (c collection) FindAll(f filter.Filter) ([]*models.Collection, filter.Metadata, error) {
+	collections, metadata, err := c.Broker.GetAll(f)
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	return collections, metadata, nil
+}
+
+func (c collection) FindForMovie(movieID int64) (*models.MovieCollection, error) {
+	mc, err := c.Broker.GetForMovie(movieID)
+	if err != nil {
+		return nil, err
+	}
+	return mc, nil
+}
+
+func (c collection) Add(col *models.Collection) (*validator.Validator, error) {
+	v := c.Validate(*col)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := c.Broker.Insert(col)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (c collection) Edit(col *models.Collection) (*validator.Validator, error) {
+	v := c.Validate(*col)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := c.Broker.Update(col)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (c collection) RemoveByID(id int64) error {
+	err := c.Broker.DeleteByID(id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c collection) AddMovie(collectionID, movieID int64) error {
+	err := c.Broker.InsertMovie(collectionID, movieID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c collection) RemoveMovie(collectionID, movieID int64) error {
+	err := c.Broker.DeleteMovie(collectionID, movieID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c collection) ReorderMovies(collectionID int64, movieIDs []int64) (*validator.Validator, error) {
+	v := validator.New()
+	v.Check(movieIDs != nil, "movie_ids", "must be provided")
+	v.Check(validator.Unique(movieIDs), "movie_ids", "must not contain duplicate values")
+	if !v.Valid() {
+		return v, nil
+	}
+	err := c.Broker.ReorderMovies(collectionID, movieIDs)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
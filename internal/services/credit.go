@@ -0,0 +1,91 @@
+package services
+
+import (
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+type credit struct {
+	Broker brokers.CreditReadWriteDeleter
+}
+
+type CreditValidator interface {
+	Validate(input models.Credit) validator.Validator
+}
+
+type CreditReader interface {
+	FindAllForMovie(movieID int64) ([]*models.Credit, error)
+	FindAllForPerson(personID int64) ([]*models.Credit, error)
+}
+
+type CreditWriter interface {
+	Add(c *models.Credit) (*validator.Validator, error)
+}
+
+type CreditDeleter interface {
+	Remove(movieID, id int64) error
+}
+
+type CreditReadWriteDeleter interface {
+	CreditValidator
+	CreditReader
+	CreditWriter
+	CreditDeleter
+}
+
+func NewCredit(b brokers.CreditReadWriteDeleter) CreditReadWriteDeleter {
+	return &credit{
+		Broker: b,
+	}
+}
+
+func (credit) Validate(input models.Credit) validator.Validator {
+	v := validator.New()
+
+	v.Check(input.PersonID > 0, "person_id", "must be provided")
+	v.Check(validator.PermittedValue(input.Role, models.CreditDirector, models.CreditWriter, models.CreditActor),
+		"role", "must be director, writer or actor")
+	v.Check(len(input.Character) <= 200, "character", "must not be more than 200 bytes long")
+	if input.Role != models.CreditActor {
+		v.Check(input.Character == "", "character", "must only be given for actors")
+	}
+	v.Check(input.Billing >= 0, "billing", "must not be negative")
+	return *v
+}
+
+func (c credit) FindAllForMovie(movieID int64) ([]*models.Credit, error) {
+	credits, err := c.Broker.GetAllForMovie(movieID)
+	if err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+func (c credit) FindAllForPerson(personID int64) ([]*models.Credit, error) {
+	credits, err := c.Broker.GetAllForPerson(personID)
+	if err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+func (c credit) Add(credit *models.Credit) (*validator.Validator, error) {
+	v := c.Validate(*credit)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := c.Broker.Insert(credit)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (c credit) Remove(movieID, id int64) error {
+	err := c.Broker.Delete(movieID, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+type genre struct {
+	Broker brokers.GenreReadWriter
+}
+
+type GenreValidator interface {
+	Validate(input models.Genre) validator.Validator
+}
+
+type GenreReader interface {
+	FindAll() ([]*models.Genre, error)
+	FindLookup() (map[string]string, error)
+}
+
+type GenreWriter interface {
+	Add(g *models.Genre) (*validator.Validator, error)
+	Merge(actorID int64, sources []string, target string) (int64, error)
+}
+
+type GenreReadWriter interface {
+	GenreValidator
+	GenreReader
+	GenreWriter
+}
+
+func NewGenre(b brokers.GenreReadWriter) GenreReadWriter {
+	return &genre{
+		Broker: b,
+	}
+}
+
+func (genre) Validate(input models.Genre) validator.Validator {
+	v := validator.New()
+
+	v.Check(input.Name != "", "name", "must be provided")
+	v.Check(len(input.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(input.Slug != "", "slug", "must be provided")
+	v.Check(models.GenreSlug(input.Slug) == input.Slug, "slug", "must only contain lowercase letters, digits and single hyphens")
+
+	v.Check(len(input.Aliases) <= 20, "aliases", "must not contain more than 20 aliases")
+	v.Check(validator.Unique(input.Aliases), "aliases", "must not contain duplicate values")
+	for _, alias := range input.Aliases {
+		v.Check(alias != "", "aliases", "must not contain empty values")
+		v.Check(alias != input.Slug, "aliases", "must not contain the genre's own slug")
+	}
+	return *v
+}
+
+// ValidateGenreMerge checks the slugs of the genres to merge and the genre they are
+// merged into.
+func ValidateGenreMerge(v *validator.Validator, sources []string, target string) {
+	v.Check(target != "", "target", "must be provided")
+	v.Check(len(sources) >= 1, "sources", "must contain at least 1 genre")
+	v.Check(len(sources) <= 20, "sources", "must not contain more than 20 genres")
+	v.Check(validator.Unique(sources), "sources", "must not contain duplicate values")
+	v.Check(!validator.PermittedValue(target, sources...), "sources", "must not contain the target genre")
+}
+
+// ResolveGenres returns the canonical slugs of the given genre names, in the same
+// order, using a lookup from FindLookup. Names are matched in slug form, so any
+// spelling of a known name or alias is accepted. An error is recorded against key if
+// any name is unknown, or if two names turn out to be the same genre.
+func ResolveGenres(v *validator.Validator, key string, names []string, lookup map[string]string) []string {
+	slugs := make([]string, 0, len(names))
+	var unknown []string
+	for _, name := range names {
+		slug, ok := lookup[models.GenreSlug(name)]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		slugs = append(slugs, slug)
+	}
+	if len(unknown) > 0 {
+		v.AddError(key, fmt.Sprintf("must only contain known genres (unknown: %s)", strings.Join(unknown, ", ")))
+		return names
+	}
+	v.Check(validator.Unique(slugs), key, "must not contain more than one name for the same genre")
+	return slugs
+}
+
+func (g genre) FindAll() ([]*models.Genre, error) {
+	genres, err := g.Broker.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return genres, nil
+}
+
+func (g genre) FindLookup() (map[string]string, error) {
+	lookup, err := g.Broker.GetLookup()
+	if err != nil {
+		return nil, err
+	}
+	return lookup, nil
+}
+
+// Add creates a genre. The slug is derived from the name if it isn't given, and the
+// aliases are put into slug form before they are validated.
+func (g genre) Add(genre *models.Genre) (*validator.Validator, error) {
+	if genre.Slug == "" {
+		genre.Slug = models.GenreSlug(genre.Name)
+	}
+	for i, alias := range genre.Aliases {
+		genre.Aliases[i] = models.GenreSlug(alias)
+	}
+
+	v := g.Validate(*genre)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := g.Broker.Insert(genre)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (g genre) Merge(actorID int64, sources []string, target string) (int64, error) {
+	changed, err := g.Broker.Merge(actorID, sources, target)
+	if err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+func TestResolveGenres(t *testing.T) {
+	// Slugs and aliases, as returned by FindLookup.
+	lookup := map[string]string{
+		"drama":           "drama",
+		"science-fiction": "science-fiction",
+		"sci-fi":          "science-fiction",
+		"animation":       "animation",
+	}
+
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+		err   string
+	}{
+		{
+			name:  "slugs",
+			names: []string{"drama", "animation"},
+			want:  []string{"drama", "animation"},
+		},
+		{
+			name:  "aliases",
+			names: []string{"animation", "sci-fi"},
+			want:  []string{"animation", "science-fiction"},
+		},
+		{
+			name:  "other spellings",
+			names: []string{"Sci Fi", "  DRAMA "},
+			want:  []string{"science-fiction", "drama"},
+		},
+		{
+			name:  "empty",
+			names: []string{},
+			want:  []string{},
+		},
+		{
+			name:  "unknown",
+			names: []string{"drama", "Western", "noir"},
+			want:  []string{"drama", "Western", "noir"},
+			err:   "must only contain known genres (unknown: Western, noir)",
+		},
+		{
+			name:  "same genre twice",
+			names: []string{"sci-fi", "Science Fiction"},
+			want:  []string{"science-fiction", "science-fiction"},
+			err:   "must not contain more than one name for the same genre",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			got := ResolveGenres(v, "genres", tt.names, lookup)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+			if msg := v.Errors["genres"]; msg != tt.err {
+				t.Errorf("error = %q; want %q", msg, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateGenreMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		target  string
+		valid   bool
+	}{
+		{"merge", []string{"sci-fi", "scifi"}, "science-fiction", true},
+		{"no target", []string{"sci-fi"}, "", false},
+		{"no sources", nil, "science-fiction", false},
+		{"duplicate sources", []string{"sci-fi", "sci-fi"}, "science-fiction", false},
+		{"target in sources", []string{"sci-fi", "science-fiction"}, "science-fiction", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateGenreMerge(v, tt.sources, tt.target)
+			if v.Valid() != tt.valid {
+				t.Errorf("valid = %t, errors %v; want valid = %t", v.Valid(), v.Errors, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/storage"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// maxImagePixels bounds the size of an uploaded image once decoded, as a small file
+// can still decode to a very large image.
+const maxImagePixels = 25_000_000
+
+// movieImage isn't called image, which would clash with the image package.
+type movieImage struct {
+	Broker  brokers.ImageReadWriteDeleter
+	Storage storage.Storage
+}
+
+type ImageValidator interface {
+	Validate(input models.Image) validator.Validator
+}
+
+type ImageReader interface {
+	FindByToken(token string) (*models.Image, error)
+	FindAllForMovie(movieID int64) ([]*models.Image, error)
+	Open(img *models.Image, variant string) (storage.File, error)
+}
+
+type ImageWriter interface {
+	Add(img *models.Image, r io.Reader) (*validator.Validator, error)
+}
+
+type ImageDeleter interface {
+	Remove(movieID int64, kind string) error
+	RemoveFiles(img *models.Image) error
+}
+
+type ImageReadWriteDeleter interface {
+	ImageValidator
+	ImageReader
+	ImageWriter
+	ImageDeleter
+}
+
+func NewImage(b brokers.ImageReadWriteDeleter, s storage.Storage) ImageReadWriteDeleter {
+	return &movieImage{
+		Broker:  b,
+		Storage: s,
+	}
+}
+
+// ValidateImageKind checks that kind is poster or backdrop.
+func ValidateImageKind(v *validator.Validator, kind string) {
+	v.Check(validator.PermittedValue(kind, models.ImagePoster, models.ImageBackdrop),
+		"kind", "must be poster or backdrop")
+}
+
+// Validate checks the dimensions of an image. Posters must be portrait and backdrops
+// landscape, and both must be large enough to fill their largest variant reasonably.
+func (movieImage) Validate(input models.Image) validator.Validator {
+	v := validator.New()
+
+	ValidateImageKind(v, input.Kind)
+	v.Check(validator.PermittedValue(input.ContentType, "image/jpeg", "image/png"),
+		"file", "must be a JPEG or PNG image")
+	v.Check(input.Width*input.Height <= maxImagePixels, "file", fmt.Sprintf("must not have more than %d pixels", maxImagePixels))
+
+	switch input.Kind {
+	case models.ImagePoster:
+		v.Check(input.Width >= 200 && input.Height >= 300, "file", "must be at least 200x300 pixels")
+		v.Check(input.Height > input.Width, "file", "must be taller than it is wide")
+	case models.ImageBackdrop:
+		v.Check(input.Width >= 640 && input.Height >= 360, "file", "must be at least 640x360 pixels")
+		v.Check(input.Width > input.Height, "file", "must be wider than it is tall")
+	}
+	return *v
+}
+
+func (m movieImage) FindByToken(token string) (*models.Image, error) {
+	img, err := m.Broker.GetByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func (m movieImage) FindAllForMovie(movieID int64) ([]*models.Image, error) {
+	images, err := m.Broker.GetAllForMovie(movieID)
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// Open returns the file for one variant of an image, or brokers.ErrRecordNotFound if
+// the image has no such variant.
+func (m movieImage) Open(img *models.Image, variant string) (storage.File, error) {
+	known := variant == models.ImageOriginal
+	for _, iv := range models.ImageVariants[img.Kind] {
+		known = known || iv.Name == variant
+	}
+	if !known {
+		return nil, brokers.ErrRecordNotFound
+	}
+	return m.Storage.Open(imageKey(img.ID, variant))
+}
+
+// Add decodes an uploaded image, which must be of the content type set on img, and
+// stores it along with its resized variants in place of any existing image of the
+// same kind. The width and height of img are filled in from the upload.
+func (m movieImage) Add(img *models.Image, r io.Reader) (*validator.Validator, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the dimensions before decoding the whole image, so that oversized
+	// images are rejected without using the memory to hold them.
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || "image/"+format != img.ContentType {
+		v := validator.New()
+		v.AddError("file", "must be a valid JPEG or PNG image")
+		return v, nil
+	}
+	img.Width, img.Height = config.Width, config.Height
+
+	v := m.Validate(*img)
+	if !v.Valid() {
+		return &v, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		v.AddError("file", "must be a valid JPEG or PNG image")
+		return &v, nil
+	}
+
+	variants := map[string][]byte{models.ImageOriginal: data}
+	flat := flattenImage(src)
+	for _, iv := range models.ImageVariants[img.Kind] {
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, resizeImage(flat, iv.Width), &jpeg.Options{Quality: 85})
+		if err != nil {
+			return nil, err
+		}
+		variants[iv.Name] = buf.Bytes()
+	}
+
+	oldID, err := m.Broker.Replace(img, func(id int64) error {
+		for name, b := range variants {
+			err := m.Storage.Put(imageKey(id, name), bytes.NewReader(b))
+			if err != nil {
+				m.Storage.Delete(imageKey(id, ""))
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The replaced image is already gone from the database, so failing to remove
+	// its files only leaves them unreachable.
+	if oldID > 0 {
+		m.Storage.Delete(imageKey(oldID, ""))
+	}
+	return nil, nil
+}
+
+func (m movieImage) Remove(movieID int64, kind string) error {
+	id, err := m.Broker.Delete(movieID, kind)
+	if err != nil {
+		return err
+	}
+	return m.Storage.Delete(imageKey(id, ""))
+}
+
+// RemoveFiles deletes the stored files of an image whose row is already gone, such as
+// one of a movie which has been purged.
+func (m movieImage) RemoveFiles(img *models.Image) error {
+	return m.Storage.Delete(imageKey(img.ID, ""))
+}
+
+// imageKey returns the storage key of a variant of an image, or of the prefix holding
+// all of its variants if variant is empty.
+func imageKey(id int64, variant string) string {
+	if variant == "" {
+		return fmt.Sprintf("images/%d", id)
+	}
+	return fmt.Sprintf("images/%d/%s", id, variant)
+}
+
+// flattenImage draws src onto a white background, so that transparent areas of a PNG
+// don't turn black in the JPEG variants.
+func flattenImage(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Over)
+	return dst
+}
+
+// resizeImage scales src down to the given width, keeping its aspect ratio, by
+// averaging the block of source pixels behind each destination pixel. Images which
+// are already narrow enough are returned unchanged.
+func resizeImage(src *image.RGBA, width int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if width >= sw {
+		return src
+	}
+	height := sh * width / sw
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					b += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// userList is named so that it doesn't clash with container/list, which the cache
+// uses.
+type userList struct {
+	Broker brokers.ListReadWriteDeleter
+}
+
+type ListValidator interface {
+	Validate(input models.List) validator.Validator
+}
+
+type ListReader interface {
+	FindByID(id int64) (*models.List, error)
+	FindBySlug(slug string) (*models.List, error)
+	FindAllForUser(userID int64) ([]*models.List, error)
+}
+
+type ListWriter interface {
+	Add(l *models.List) (*validator.Validator, error)
+	AddWatchlist(userID int64) error
+	Edit(l *models.List) (*validator.Validator, error)
+	AddItem(listID, movieID int64) (*models.ListItem, error)
+	ReorderItems(listID int64, movieIDs []int64) (*validator.Validator, error)
+}
+
+type ListDeleter interface {
+	RemoveByID(id int64) error
+	RemoveItem(listID, movieID int64) error
+}
+
+type ListReadWriteDeleter interface {
+	ListValidator
+	ListReader
+	ListWriter
+	ListDeleter
+}
+
+func NewList(b brokers.ListReadWriteDeleter) ListReadWriteDeleter {
+	return &userList{
+		Broker: b,
+	}
+}
+
+func (userList) Validate(input models.List) validator.Validator {
+	v := validator.New()
+
+	v.Check(input.Name != "", "name", "must be provided")
+	v.Check(len(input.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	// The watchlist keeps its name, and no other list may take it, so that the
+	// watchlist can always be created for a user who doesn't have one yet.
+	if input.Watchlist {
+		v.Check(input.Name == models.WatchlistName, "name", "the watchlist can't be renamed")
+	} else {
+		v.Check(!strings.EqualFold(input.Name, models.WatchlistName), "name", "is reserved for the watchlist")
+	}
+	return *v
+}
+
+func (l userList) FindByID(id int64) (*models.List, error) {
+	list, err := l.Broker.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l userList) FindBySlug(slug string) (*models.List, error) {
+	list, err := l.Broker.GetBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l userList) FindAllForUser(userID int64) ([]*models.List, error) {
+	lists, err := l.Broker.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (l userList) AddWatchlist(userID int64) error {
+	err := l.Broker.InsertWatchlist(userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (l userList) Add(list *models.List) (*validator.Validator, error) {
+	v := l.Validate(*list)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := setListSlug(list)
+	if err != nil {
+		return nil, err
+	}
+	err = l.Broker.Insert(list)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (l userList) Edit(list *models.List) (*validator.Validator, error) {
+	v := l.Validate(*list)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := setListSlug(list)
+	if err != nil {
+		return nil, err
+	}
+	err = l.Broker.Update(list)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// setListSlug gives a public list a slug the first time it is shared. The slug is
+// kept if the list is made private again, so sharing it a second time gives the same
+// link.
+func setListSlug(list *models.List) error {
+	if !list.Public || list.Slug != "" {
+		return nil
+	}
+	slug, err := models.GenerateListSlug()
+	if err != nil {
+		return err
+	}
+	list.Slug = slug
+	return nil
+}
+
+func (l userList) RemoveByID(id int64) error {
+	err := l.Broker.DeleteByID(id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (l userList) AddItem(listID, movieID int64) (*models.ListItem, error) {
+	item, err := l.Broker.InsertItem(listID, movieID)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (l userList) RemoveItem(listID, movieID int64) error {
+	err := l.Broker.DeleteItem(listID, movieID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (l userList) ReorderItems(listID int64, movieIDs []int64) (*validator.Validator, error) {
+	v := validator.New()
+	v.Check(movieIDs != nil, "movie_ids", "must be provided")
+	v.Check(validator.Unique(movieIDs), "movie_ids", "must not contain duplicate values")
+	if !v.Valid() {
+		return v, nil
+	}
+	err := l.Broker.ReorderItems(listID, movieIDs)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
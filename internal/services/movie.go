@@ -1,6 +1,9 @@
 package services
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/rwx-yxu/greenlight/internal/brokers"
@@ -11,6 +14,7 @@ import (
 
 type movie struct {
 	Broker brokers.MovieReadWriteDeleter
+	Genre  brokers.GenreReader
 }
 
 type MovieValidator interface {
@@ -19,16 +23,28 @@ type MovieValidator interface {
 
 type MovieReader interface {
 	FindByID(id int64) (*models.Movie, error)
-	FindAll(title string, genres []string, filters filter.Filter) ([]*models.Movie, filter.Metadata, error)
+	FindByExternalID(source, externalID string) (*models.Movie, error)
+	FindUsedExternalIDs(ids []models.ExternalID) (map[models.ExternalID]bool, error)
+	FindAll(f filter.MovieFilter) ([]*models.Movie, filter.Metadata, error)
+	FindSuggestions(q string, threshold float64, limit int) ([]*models.MovieSuggestion, error)
+	FindAllDeleted(f filter.Filter) ([]*models.Movie, filter.Metadata, error)
+	FindRevisions(movieID int64, f filter.Filter) ([]*models.MovieRevision, filter.Metadata, error)
+	FindRevision(movieID int64, version int32) (*models.MovieRevision, error)
+	Export(ctx context.Context, f filter.MovieFilter, fn func(*models.Movie) error) error
 }
 
 type MovieWriter interface {
-	Add(m *models.Movie) (*validator.Validator, error)
-	Edit(m *models.Movie) (*validator.Validator, error)
+	Add(actorID int64, m *models.Movie) (*validator.Validator, error)
+	AddBatch(actorID int64, movies []*models.Movie) error
+	UpsertBatch(actorID int64, source string, movies []*models.Movie) (created, updated int, err error)
+	Edit(actorID int64, m *models.Movie) (*validator.Validator, error)
+	Restore(actorID, id int64) (*models.Movie, error)
 }
 
 type MovieDeleter interface {
-	RemoveByID(id int64) error
+	RemoveByID(actorID, id int64) error
+	RemoveByIDAndVersion(actorID, id int64, version int32) error
+	Purge(id int64) error
 }
 
 type MovieReadWriteDeleter interface {
@@ -38,9 +54,10 @@ type MovieReadWriteDeleter interface {
 	MovieReader
 }
 
-func NewMovie(b brokers.MovieReadWriteDeleter) MovieReadWriteDeleter {
+func NewMovie(b brokers.MovieReadWriteDeleter, gb brokers.GenreReader) MovieReadWriteDeleter {
 	return &movie{
 		Broker: b,
+		Genre:  gb,
 	}
 }
 
@@ -69,9 +86,73 @@ func (movie) Validate(input models.Movie) validator.Validator {
 	// Note that we're using the Unique helper in the line below to check that all
 	// values in the input.Genres slice are unique.
 	v.Check(validator.Unique(input.Genres), "genres", "must not contain duplicate values")
+
+	sources := make([]string, 0, len(input.ExternalIDs))
+	for source := range input.ExternalIDs {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		ValidateExternalID(v, "external_ids", source, input.ExternalIDs[source])
+	}
 	return *v
 }
 
+// ValidateExternalID checks that the source is known and the id looks like one of its
+// identifiers. The id should already be normalised.
+func ValidateExternalID(v *validator.Validator, key, source, id string) {
+	rx, ok := models.ExternalIDRX[source]
+	if !ok {
+		v.AddError(key, fmt.Sprintf("%q is not a supported source", source))
+		return
+	}
+	v.Check(validator.Matches(id, rx), key, fmt.Sprintf("must contain a valid %s id", source))
+}
+
+// validateGenres validates the movie and then resolves its genres against the
+// taxonomy, returning a non-nil Validator if either fails.
+func (m movie) validateGenres(movie *models.Movie) (*validator.Validator, error) {
+	v := m.Validate(*movie)
+	if !v.Valid() {
+		return &v, nil
+	}
+	lookup, err := m.Genre.GetLookup()
+	if err != nil {
+		return nil, err
+	}
+	if movie.Genres = ResolveGenres(&v, "genres", movie.Genres, lookup); !v.Valid() {
+		return &v, nil
+	}
+	return nil, nil
+}
+
+// canonicalFilter replaces the genres in a movie filter with their canonical slugs, so
+// that movies can be filtered by any name of a genre. Unknown genres are left in slug
+// form, where they simply match nothing.
+func (m movie) canonicalFilter(f filter.MovieFilter) (filter.MovieFilter, error) {
+	if len(f.Genres) == 0 && len(f.GenresAny) == 0 && len(f.ExcludeGenres) == 0 {
+		return f, nil
+	}
+	lookup, err := m.Genre.GetLookup()
+	if err != nil {
+		return f, err
+	}
+	canonical := func(names []string) []string {
+		slugs := make([]string, len(names))
+		for i, name := range names {
+			slugs[i] = models.GenreSlug(name)
+			if slug, ok := lookup[slugs[i]]; ok {
+				slugs[i] = slug
+			}
+		}
+		return slugs
+	}
+	f.Genres = canonical(f.Genres)
+	f.GenresAny = canonical(f.GenresAny)
+	f.ExcludeGenres = canonical(f.ExcludeGenres)
+	return f, nil
+}
+
 func (m movie) FindByID(id int64) (*models.Movie, error) {
 	movie, err := m.Broker.GetByID(id)
 	if err != nil {
@@ -80,42 +161,155 @@ func (m movie) FindByID(id int64) (*models.Movie, error) {
 	return movie, nil
 }
 
-func (m movie) Add(movie *models.Movie) (*validator.Validator, error) {
-	v := m.Validate(*movie)
-	if !v.Valid() {
-		return &v, nil
+func (m movie) FindByExternalID(source, externalID string) (*models.Movie, error) {
+	movie, err := m.Broker.GetByExternalID(source, externalID)
+	if err != nil {
+		return nil, err
 	}
-	err := m.Broker.Insert(movie)
+	return movie, nil
+}
+
+func (m movie) FindUsedExternalIDs(ids []models.ExternalID) (map[models.ExternalID]bool, error) {
+	used, err := m.Broker.GetUsedExternalIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	return used, nil
+}
+
+// Add creates a movie once it is valid and all of its genres are known. The genres are
+// replaced with their canonical slugs and the external ids normalised.
+func (m movie) Add(actorID int64, movie *models.Movie) (*validator.Validator, error) {
+	models.NormaliseExternalIDs(movie.ExternalIDs)
+	v, err := m.validateGenres(movie)
+	if v != nil || err != nil {
+		return v, err
+	}
+	err = m.Broker.Insert(actorID, movie)
 	if err != nil {
 		return nil, err
 	}
 	return nil, nil
 }
 
-func (m movie) Edit(movie *models.Movie) (*validator.Validator, error) {
-	v := m.Validate(*movie)
-	if !v.Valid() {
-		return &v, nil
+// AddBatch creates several movies at once. Unlike Add it doesn't validate them or
+// resolve their genres, as bulk callers need to do so for each movie up front in order
+// to report on it, and only pass the valid ones on.
+func (m movie) AddBatch(actorID int64, movies []*models.Movie) error {
+	err := m.Broker.InsertBatch(actorID, movies)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpsertBatch creates or updates several movies at once, matching them to existing
+// movies by their external id from source. Like AddBatch it doesn't validate them.
+func (m movie) UpsertBatch(actorID int64, source string, movies []*models.Movie) (int, int, error) {
+	created, updated, err := m.Broker.UpsertBatch(actorID, source, movies)
+	if err != nil {
+		return 0, 0, err
+	}
+	return created, updated, nil
+}
+
+func (m movie) Edit(actorID int64, movie *models.Movie) (*validator.Validator, error) {
+	models.NormaliseExternalIDs(movie.ExternalIDs)
+	v, err := m.validateGenres(movie)
+	if v != nil || err != nil {
+		return v, err
 	}
-	err := m.Broker.Update(movie)
+	err = m.Broker.Update(actorID, movie)
 	if err != nil {
 		return nil, err
 	}
 	return nil, nil
 }
 
-func (m movie) RemoveByID(id int64) error {
-	err := m.Broker.DeleteByID(id)
+func (m movie) RemoveByID(actorID, id int64) error {
+	err := m.Broker.DeleteByID(actorID, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (m movie) FindAll(title string, genres []string, f filter.Filter) ([]*models.Movie, filter.Metadata, error) {
-	movies, metadata, err := m.Broker.GetAll(title, genres, f)
+func (m movie) FindAll(f filter.MovieFilter) ([]*models.Movie, filter.Metadata, error) {
+	f, err := m.canonicalFilter(f)
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	movies, metadata, err := m.Broker.GetAll(f)
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	return movies, metadata, nil
+}
+
+func (m movie) FindSuggestions(q string, threshold float64, limit int) ([]*models.MovieSuggestion, error) {
+	suggestions, err := m.Broker.GetSuggestions(q, threshold, limit)
+	if err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+func (m movie) RemoveByIDAndVersion(actorID, id int64, version int32) error {
+	err := m.Broker.DeleteByIDAndVersion(actorID, id, version)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m movie) FindAllDeleted(f filter.Filter) ([]*models.Movie, filter.Metadata, error) {
+	movies, metadata, err := m.Broker.GetAllDeleted(f)
 	if err != nil {
 		return nil, filter.Metadata{}, err
 	}
 	return movies, metadata, nil
 }
+
+func (m movie) Restore(actorID, id int64) (*models.Movie, error) {
+	movie, err := m.Broker.Restore(actorID, id)
+	if err != nil {
+		return nil, err
+	}
+	return movie, nil
+}
+
+func (m movie) Purge(id int64) error {
+	err := m.Broker.Purge(id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m movie) FindRevisions(movieID int64, f filter.Filter) ([]*models.MovieRevision, filter.Metadata, error) {
+	revisions, metadata, err := m.Broker.GetRevisions(movieID, f)
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	return revisions, metadata, nil
+}
+
+func (m movie) FindRevision(movieID int64, version int32) (*models.MovieRevision, error) {
+	revision, err := m.Broker.GetRevision(movieID, version)
+	if err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+func (m movie) Export(ctx context.Context, f filter.MovieFilter, fn func(*models.Movie) error) error {
+	f, err := m.canonicalFilter(f)
+	if err != nil {
+		return err
+	}
+	err = m.Broker.Export(ctx, f, fn)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"github.com/rwx-yxu/greenlight/internal/brokers"
 	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
 )
 
 type permission struct {
@@ -11,10 +12,13 @@ type permission struct {
 
 type PermissionReader interface {
 	FindAllForUser(userID int64) (models.Permissions, error)
+	FindHistoryForUser(userID int64) ([]*models.PermissionChange, error)
 }
 
 type PermissionWriter interface {
 	AddForUser(userID int64, codes ...string) error
+	GrantForUser(actorID, userID int64, codes ...string) error
+	RevokeForUser(actorID, userID int64, codes ...string) error
 }
 
 type PermissionReadWriter interface {
@@ -28,6 +32,11 @@ func NewPermission(b brokers.PermissionReadWriter) PermissionReadWriter {
 	}
 }
 
+func ValidatePermissionCodes(v *validator.Validator, codes []string) {
+	v.Check(len(codes) >= 1, "codes", "must contain at least 1 permission code")
+	v.Check(validator.Unique(codes), "codes", "must not contain duplicate values")
+}
+
 func (p permission) FindAllForUser(userID int64) (models.Permissions, error) {
 	perms, err := p.Broker.GetAllForUser(userID)
 	if err != nil {
@@ -44,3 +53,27 @@ func (p permission) AddForUser(userID int64, codes ...string) error {
 	}
 	return nil
 }
+
+func (p permission) FindHistoryForUser(userID int64) ([]*models.PermissionChange, error) {
+	changes, err := p.Broker.GetHistoryForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (p permission) GrantForUser(actorID, userID int64, codes ...string) error {
+	err := p.Broker.GrantForUser(actorID, userID, codes...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p permission) RevokeForUser(actorID, userID int64, codes ...string) error {
+	err := p.Broker.DeleteForUser(actorID, userID, codes...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+type person struct {
+	Broker brokers.PersonReadWriteDeleter
+}
+
+type PersonValidator interface {
+	Validate(input models.Person) validator.Validator
+}
+
+type PersonReader interface {
+	FindByID(id int64) (*models.Person, error)
+}
+
+type PersonWriter interface {
+	Add(p *models.Person) (*validator.Validator, error)
+	Edit(p *models.Person) (*validator.Validator, error)
+}
+
+type PersonDeleter interface {
+	RemoveByID(id int64) error
+}
+
+type PersonReadWriteDeleter interface {
+	PersonValidator
+	PersonReader
+	PersonWriter
+	PersonDeleter
+}
+
+func NewPerson(b brokers.PersonReadWriteDeleter) PersonReadWriteDeleter {
+	return &person{
+		Broker: b,
+	}
+}
+
+func (person) Validate(input models.Person) validator.Validator {
+	v := validator.New()
+
+	v.Check(input.Name != "", "name", "must be provided")
+	v.Check(len(input.Name) <= 200, "name", "must not be more than 200 bytes long")
+	return *v
+}
+
+func (p person) FindByID(id int64) (*models.Person, error) {
+	person, err := p.Broker.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return person, nil
+}
+
+func (p person) Add(person *models.Person) (*validator.Validator, error) {
+	v := p.Validate(*person)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := p.Broker.Insert(person)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (p person) Edit(person *models.Person) (*validator.Validator, error) {
+	v := p.Validate(*person)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := p.Broker.Update(person)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (p person) RemoveByID(id int64) error {
+	err := p.Broker.DeleteByID(id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
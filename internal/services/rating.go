@@ -0,0 +1,63 @@
+package services
+
+import (
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+type rating struct {
+	Broker brokers.RatingWriteDeleter
+}
+
+type RatingValidator interface {
+	Validate(input models.Rating) validator.Validator
+}
+
+type RatingWriter interface {
+	Set(r *models.Rating) (*validator.Validator, error)
+}
+
+type RatingDeleter interface {
+	Remove(movieID, userID int64) error
+}
+
+type RatingWriteDeleter interface {
+	RatingValidator
+	RatingWriter
+	RatingDeleter
+}
+
+func NewRating(b brokers.RatingWriteDeleter) RatingWriteDeleter {
+	return &rating{
+		Broker: b,
+	}
+}
+
+func (rating) Validate(input models.Rating) validator.Validator {
+	v := validator.New()
+
+	v.Check(input.Score >= 1, "score", "must be at least 1")
+	v.Check(input.Score <= 10, "score", "must not be more than 10")
+	return *v
+}
+
+func (r rating) Set(rating *models.Rating) (*validator.Validator, error) {
+	v := r.Validate(*rating)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := r.Broker.Upsert(rating)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (r rating) Remove(movieID, userID int64) error {
+	err := r.Broker.Delete(movieID, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
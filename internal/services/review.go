@@ -0,0 +1,128 @@
+package services
+
+import (
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/filter"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+type review struct {
+	Broker brokers.ReviewReadWriteDeleter
+}
+
+type ReviewValidator interface {
+	Validate(input models.Review) validator.Validator
+}
+
+type ReviewReader interface {
+	FindByID(id int64) (*models.Review, error)
+	FindAllForMovie(movieID, viewerID int64, f filter.Filter) ([]*models.Review, filter.Metadata, error)
+	FindAllByStatus(status string, f filter.Filter) ([]*models.Review, filter.Metadata, error)
+}
+
+type ReviewWriter interface {
+	Add(r *models.Review) (*validator.Validator, error)
+	Edit(r *models.Review) (*validator.Validator, error)
+	Moderate(r *models.Review) (*validator.Validator, error)
+}
+
+type ReviewDeleter interface {
+	RemoveByID(id int64) error
+}
+
+type ReviewReadWriteDeleter interface {
+	ReviewValidator
+	ReviewReader
+	ReviewWriter
+	ReviewDeleter
+}
+
+func NewReview(b brokers.ReviewReadWriteDeleter) ReviewReadWriteDeleter {
+	return &review{
+		Broker: b,
+	}
+}
+
+func (review) Validate(input models.Review) validator.Validator {
+	v := validator.New()
+
+	v.Check(input.Body != "", "body", "must be provided")
+	v.Check(len(input.Body) <= 10_000, "body", "must not be more than 10000 bytes long")
+	return *v
+}
+
+// ValidateReviewStatus checks that status is one of the moderation states.
+func ValidateReviewStatus(v *validator.Validator, status string) {
+	v.Check(validator.PermittedValue(status, models.ReviewPending, models.ReviewApproved, models.ReviewRejected),
+		"status", "must be pending, approved or rejected")
+}
+
+func (r review) FindByID(id int64) (*models.Review, error) {
+	review, err := r.Broker.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+func (r review) FindAllForMovie(movieID, viewerID int64, f filter.Filter) ([]*models.Review, filter.Metadata, error) {
+	reviews, metadata, err := r.Broker.GetAllForMovie(movieID, viewerID, f)
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	return reviews, metadata, nil
+}
+
+func (r review) FindAllByStatus(status string, f filter.Filter) ([]*models.Review, filter.Metadata, error) {
+	reviews, metadata, err := r.Broker.GetAllByStatus(status, f)
+	if err != nil {
+		return nil, filter.Metadata{}, err
+	}
+	return reviews, metadata, nil
+}
+
+func (r review) Add(review *models.Review) (*validator.Validator, error) {
+	v := r.Validate(*review)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := r.Broker.Insert(review)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (r review) Edit(review *models.Review) (*validator.Validator, error) {
+	v := r.Validate(*review)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := r.Broker.Update(review)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (r review) Moderate(review *models.Review) (*validator.Validator, error) {
+	v := validator.New()
+	ValidateReviewStatus(v, review.Status)
+	if !v.Valid() {
+		return v, nil
+	}
+	err := r.Broker.UpdateStatus(review)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (r review) RemoveByID(id int64) error {
+	err := r.Broker.DeleteByID(id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"regexp"
+
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+)
+
+// Role names are short lowercase identifiers such as "viewer" or "content-editor".
+var RoleNameRX = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+type role struct {
+	Broker brokers.RoleReadWriteDeleter
+}
+
+type RoleValidator interface {
+	Validate(input models.Role) validator.Validator
+}
+
+type RoleReader interface {
+	FindByID(id int64) (*models.Role, error)
+	FindAll() ([]*models.Role, error)
+}
+
+type RoleWriter interface {
+	Add(r *models.Role) (*validator.Validator, error)
+	Edit(actorID int64, r *models.Role) (*validator.Validator, error)
+	AddForUser(actorID, roleID, userID int64) error
+	RemoveForUser(actorID, roleID, userID int64) error
+}
+
+type RoleDeleter interface {
+	RemoveByID(actorID, id int64) error
+}
+
+type RoleReadWriteDeleter interface {
+	RoleValidator
+	RoleReader
+	RoleWriter
+	RoleDeleter
+}
+
+func NewRole(b brokers.RoleReadWriteDeleter) RoleReadWriteDeleter {
+	return &role{
+		Broker: b,
+	}
+}
+
+func (role) Validate(input models.Role) validator.Validator {
+	v := validator.New()
+
+	v.Check(input.Name != "", "name", "must be provided")
+	v.Check(len(input.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(input.Name, RoleNameRX), "name", "must only contain lowercase letters, digits, hyphens and underscores")
+
+	v.Check(len(input.Description) <= 500, "description", "must not be more than 500 bytes long")
+
+	// Whether each code actually exists is checked by the broker, because the
+	// permissions table is the only source of truth for that.
+	v.Check(input.Permissions != nil, "permissions", "must be provided")
+	v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values")
+	return *v
+}
+
+func (r role) FindByID(id int64) (*models.Role, error) {
+	role, err := r.Broker.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (r role) FindAll() ([]*models.Role, error) {
+	roles, err := r.Broker.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r role) Add(role *models.Role) (*validator.Validator, error) {
+	v := r.Validate(*role)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := r.Broker.Insert(role)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (r role) Edit(actorID int64, role *models.Role) (*validator.Validator, error) {
+	v := r.Validate(*role)
+	if !v.Valid() {
+		return &v, nil
+	}
+	err := r.Broker.Update(actorID, role)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (r role) RemoveByID(actorID, id int64) error {
+	err := r.Broker.DeleteByID(actorID, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r role) AddForUser(actorID, roleID, userID int64) error {
+	err := r.Broker.InsertForUser(actorID, roleID, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r role) RemoveForUser(actorID, roleID, userID int64) error {
+	err := r.Broker.DeleteForUser(actorID, roleID, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
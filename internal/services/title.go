@@ -0,0 +1,143 @@
+package services
+
+import (
+	"github.com/rwx-yxu/greenlight/internal/brokers"
+	"github.com/rwx-yxu/greenlight/internal/models"
+	"github.com/rwx-yxu/greenlight/internal/validator"
+	"golang.org/x/text/language"
+)
+
+type title struct {
+	Broker brokers.TitleReadWriteDeleter
+	// Original is the language original titles are taken to be in.
+	Original language.Tag
+}
+
+type TitleValidator interface {
+	Validate(input models.MovieTitle) validator.Validator
+}
+
+type TitleReader interface {
+	FindAllForMovie(movieID int64) ([]*models.MovieTitle, error)
+	Localise(movies []*models.Movie, prefs []language.Tag) error
+}
+
+type TitleWriter interface {
+	Set(t *models.MovieTitle) (*validator.Validator, error)
+}
+
+type TitleDeleter interface {
+	Remove(movieID int64, language string) error
+}
+
+type TitleReadWriteDeleter interface {
+	TitleValidator
+	TitleReader
+	TitleWriter
+	TitleDeleter
+}
+
+// NewTitle returns the title service. Movies don't record the language of their
+// original title, so every original title is taken to be in the language original,
+// and clients preferring that language are shown it rather than an alternate title.
+func NewTitle(b brokers.TitleReadWriteDeleter, original language.Tag) TitleReadWriteDeleter {
+	return &title{
+		Broker:   b,
+		Original: original,
+	}
+}
+
+// CanonicalLanguage returns the canonical form of a BCP 47 language tag, such as
+// "pt-BR" for "pt-br", and false if s isn't a well-formed tag.
+func CanonicalLanguage(s string) (string, bool) {
+	tag, err := language.Parse(s)
+	if err != nil || tag == language.Und {
+		return "", false
+	}
+	return tag.String(), true
+}
+
+func (title) Validate(input models.MovieTitle) validator.Validator {
+	v := validator.New()
+
+	canonical, ok := CanonicalLanguage(input.Language)
+	v.Check(ok, "language", "must be a BCP 47 language tag such as fr or pt-BR")
+	v.Check(!ok || canonical == input.Language, "language", "must be written as "+canonical)
+
+	v.Check(input.Title != "", "title", "must be provided")
+	v.Check(len(input.Title) <= 500, "title", "must not be more than 500 bytes long")
+	return *v
+}
+
+func (t title) FindAllForMovie(movieID int64) ([]*models.MovieTitle, error) {
+	titles, err := t.Broker.GetAllForMovies([]int64{movieID})
+	if err != nil {
+		return nil, err
+	}
+	if titles[movieID] == nil {
+		return []*models.MovieTitle{}, nil
+	}
+	return titles[movieID], nil
+}
+
+// Localise replaces the title of each movie with its alternate title which best
+// matches the given languages, in order of preference, keeping the original title in
+// OriginalTitle. Movies with no alternate title in an acceptable language are left as
+// they are.
+func (t title) Localise(movies []*models.Movie, prefs []language.Tag) error {
+	if len(movies) == 0 || len(prefs) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+	titles, err := t.Broker.GetAllForMovies(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		if len(titles[movie.ID]) == 0 {
+			continue
+		}
+		// The original title comes first, which also makes it the matcher's fallback
+		// when none of the alternate titles is an acceptable match.
+		tags := []language.Tag{t.Original}
+		for _, mt := range titles[movie.ID] {
+			tags = append(tags, language.Make(mt.Language))
+		}
+		_, index, confidence := language.NewMatcher(tags).Match(prefs...)
+		if index == 0 || confidence == language.No {
+			continue
+		}
+		mt := titles[movie.ID][index-1]
+		movie.OriginalTitle = movie.Title
+		movie.Title = mt.Title
+		movie.TitleLanguage = mt.Language
+	}
+	return nil
+}
+
+// Set validates a title and saves it for its movie and language.
+func (t title) Set(mt *models.MovieTitle) (*validator.Validator, error) {
+	v := t.Validate(*mt)
+	if !v.Valid() {
+		return &v, nil
+	}
+	mt.SearchConfig = models.TitleSearchConfig(mt.Language)
+	err := t.Broker.Upsert(mt)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (t title) Remove(movieID int64, language string) error {
+	err := t.Broker.Delete(movieID, language)
+	if err != nil {
+		return err
+	}
+	return nil
+}
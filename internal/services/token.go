@@ -1,6 +1,8 @@
 package services
 
 import (
+	"crypto/sha256"
+
 	"github.com/rwx-yxu/greenlight/internal/brokers"
 	"github.com/rwx-yxu/greenlight/internal/models"
 	"github.com/rwx-yxu/greenlight/internal/validator"
@@ -20,6 +22,7 @@ type TokenWriter interface {
 
 type TokenDeleter interface {
 	RemoveAllForUser(scope string, userID int64) error
+	Remove(scope, tokenPlaintext string) error
 }
 
 type TokenWriteDeleter interface {
@@ -58,3 +61,14 @@ func (t token) RemoveAllForUser(scope string, userID int64) error {
 	}
 	return nil
 }
+
+func (t token) Remove(scope, tokenPlaintext string) error {
+	// Tokens are only ever stored as a SHA-256 hash, so hash the plaintext the same
+	// way GenerateToken() does before looking it up.
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	err := t.Broker.DeleteByHash(scope, hash[:])
+	if err != nil {
+		return err
+	}
+	return nil
+}
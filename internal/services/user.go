@@ -1,6 +1,8 @@
 package services
 
 import (
+	"time"
+
 	"github.com/rwx-yxu/greenlight/internal/brokers"
 	"github.com/rwx-yxu/greenlight/internal/models"
 	"github.com/rwx-yxu/greenlight/internal/validator"
@@ -13,6 +15,7 @@ type user struct {
 type UserReader interface {
 	FindByEmail(email string) (*models.User, error)
 	FindByToken(scope, tokenPlainText string) (*models.User, error)
+	FindByTokenWithExpiry(scope, tokenPlainText string) (*models.User, time.Time, error)
 }
 
 type UserWriter interface {
@@ -91,13 +94,22 @@ func (u user) Edit(user *models.User) (*validator.Validator, error) {
 }
 
 func (u user) FindByToken(scope, tokenPlainText string) (*models.User, error) {
-	user, err := u.Broker.GetByToken(scope, tokenPlainText)
+	user, _, err := u.Broker.GetByToken(scope, tokenPlainText)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
+// FindByTokenWithExpiry is FindByToken but also returns when the token expires.
+func (u user) FindByTokenWithExpiry(scope, tokenPlainText string) (*models.User, time.Time, error) {
+	user, expiry, err := u.Broker.GetByToken(scope, tokenPlainText)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return user, expiry, nil
+}
+
 func (u user) FindByEmail(email string) (*models.User, error) {
 
 	user, err := u.Broker.GetByEmail(email)
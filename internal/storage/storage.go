@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// A File is an open stored file. It can be passed straight to http.ServeContent.
+type File interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// Storage keeps files, such as uploaded images, under slash separated keys like
+// "images/12/original". Keys may not contain "." or ".." elements.
+type Storage interface {
+	// Put stores the contents of r under key, replacing any existing file. A file
+	// is never visible with only part of its contents.
+	Put(key string, r io.Reader) error
+	// Open returns the file stored under key, or an error wrapping fs.ErrNotExist if
+	// there isn't one.
+	Open(key string) (File, error)
+	// Delete removes the file stored under key, or every file below it if key is a
+	// prefix such as "images/12". Deleting a key which doesn't exist is not an error.
+	Delete(key string) error
+}
+
+type local struct {
+	root string
+}
+
+// NewLocal returns a Storage which keeps files in the directory root, which is created
+// if it doesn't exist yet.
+func NewLocal(root string) (Storage, error) {
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &local{root: root}, nil
+}
+
+func (l local) path(key string) (string, error) {
+	if !fs.ValidPath(key) || key == "." {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file in the destination directory and renames it into
+// place once it is complete.
+func (l local) Put(key string, r io.Reader) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l local) Open(key string) (File, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (l local) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS users_permissions_audit (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    actor_id bigint REFERENCES users ON DELETE SET NULL,
+    code text NOT NULL,
+    action text NOT NULL CHECK (action IN ('grant', 'revoke'))
+);
+
+CREATE INDEX IF NOT EXISTS users_permissions_audit_user_id_idx ON users_permissions_audit (user_id);
+
+-- Add the permission required to grant and revoke user permissions, and bundle it
+-- into the admin role.
+INSERT INTO permissions (code)
+VALUES
+    ('users:admin');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'users:admin';
@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE code = 'movies:purge';
+DROP INDEX IF EXISTS movies_deleted_at_idx;
+-- Without the column trashed movies would reappear, so purge them first.
+DELETE FROM movies WHERE deleted_at IS NOT NULL;
+ALTER TABLE movies DROP COLUMN IF EXISTS deleted_at;
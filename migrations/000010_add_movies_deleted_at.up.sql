@@ -0,0 +1,16 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+-- Only trashed movies are indexed, which keeps the index small and serves the trash
+-- listing ordered by when each movie was deleted.
+CREATE INDEX IF NOT EXISTS movies_deleted_at_idx ON movies (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Add the permission required to permanently delete a trashed movie, and bundle it
+-- into the admin role.
+INSERT INTO permissions (code)
+VALUES
+    ('movies:purge');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'movies:purge';
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    version integer NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    action text NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore')),
+    before jsonb,
+    after jsonb,
+    UNIQUE (movie_id, version)
+);
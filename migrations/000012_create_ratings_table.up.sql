@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS ratings (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    score smallint NOT NULL CHECK (score BETWEEN 1 AND 10),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (movie_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS ratings_user_id_idx ON ratings (user_id);
+
+-- The average score and number of ratings are kept on each movie, so that they can be
+-- returned and sorted on without aggregating the ratings table on every list.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating real NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS votes integer NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS movies_rating_idx ON movies (rating);
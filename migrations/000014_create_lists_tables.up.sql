@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS lists (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    watchlist boolean NOT NULL DEFAULT false,
+    public boolean NOT NULL DEFAULT false,
+    slug text UNIQUE,
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT lists_user_id_name_key UNIQUE (user_id, name)
+);
+
+-- Every user has at most one watchlist.
+CREATE UNIQUE INDEX IF NOT EXISTS lists_user_id_watchlist_idx ON lists (user_id) WHERE watchlist;
+
+CREATE TABLE IF NOT EXISTS list_items (
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer NOT NULL,
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, movie_id)
+);
@@ -0,0 +1,129 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    slug text NOT NULL UNIQUE,
+    name text NOT NULL
+);
+
+-- Every name a genre is known by, including its own slug, so that a genre name can be
+-- resolved with a single lookup and a slug can never also be another genre's alias.
+-- Aliases are stored in slug form.
+CREATE TABLE IF NOT EXISTS genre_aliases (
+    alias text PRIMARY KEY,
+    genre_id bigint NOT NULL REFERENCES genres ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS genre_aliases_genre_id_idx ON genre_aliases (genre_id);
+
+INSERT INTO genres (slug, name)
+VALUES
+    ('action', 'Action'),
+    ('adventure', 'Adventure'),
+    ('animation', 'Animation'),
+    ('biography', 'Biography'),
+    ('comedy', 'Comedy'),
+    ('crime', 'Crime'),
+    ('documentary', 'Documentary'),
+    ('drama', 'Drama'),
+    ('family', 'Family'),
+    ('fantasy', 'Fantasy'),
+    ('history', 'History'),
+    ('horror', 'Horror'),
+    ('music', 'Music'),
+    ('musical', 'Musical'),
+    ('mystery', 'Mystery'),
+    ('romance', 'Romance'),
+    ('science-fiction', 'Science Fiction'),
+    ('sport', 'Sport'),
+    ('thriller', 'Thriller'),
+    ('war', 'War'),
+    ('western', 'Western')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genre_aliases (alias, genre_id)
+SELECT aliases.alias, genres.id
+FROM (VALUES
+    ('animated', 'animation'),
+    ('biopic', 'biography'),
+    ('romantic', 'romance'),
+    ('sci-fi', 'science-fiction'),
+    ('scifi', 'science-fiction'),
+    ('sf', 'science-fiction'),
+    ('sports', 'sport')
+) AS aliases (alias, slug)
+INNER JOIN genres ON genres.slug = aliases.slug;
+
+-- Add any genres already used by movies which aren't known under some name yet, so
+-- that no movie loses a genre. The expression below must match models.GenreSlug.
+INSERT INTO genres (slug, name)
+SELECT DISTINCT g.slug, initcap(replace(g.slug, '-', ' '))
+FROM movies, unnest(movies.genres) AS u(genre),
+    LATERAL (SELECT trim(BOTH '-' FROM regexp_replace(lower(u.genre), '[^a-z0-9]+', '-', 'g')) AS slug) AS g
+WHERE g.slug <> ''
+AND NOT EXISTS (SELECT 1 FROM genre_aliases WHERE genre_aliases.alias = g.slug)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genre_aliases (alias, genre_id)
+SELECT slug, id
+FROM genres
+ON CONFLICT DO NOTHING;
+
+-- Rewrite each movie's genres to their canonical slugs, keeping their order and
+-- dropping any which become duplicates. The version is bumped on the movies which
+-- change so that clients holding an old copy see the change, and an update revision
+-- is recorded for each of them, with no user, so that the revision history stays
+-- complete. The before and after snapshots are built in the same form as the movie
+-- broker stores them.
+WITH normalised AS (
+    SELECT movies.id, movies.genres AS old_genres, ARRAY(
+        SELECT genres.slug
+        FROM unnest(movies.genres) WITH ORDINALITY AS u(genre, n)
+        INNER JOIN genre_aliases
+            ON genre_aliases.alias = trim(BOTH '-' FROM regexp_replace(lower(u.genre), '[^a-z0-9]+', '-', 'g'))
+        INNER JOIN genres ON genres.id = genre_aliases.genre_id
+        GROUP BY genres.slug
+        ORDER BY min(u.n)
+    ) AS genres
+    FROM movies
+), changed AS (
+    UPDATE movies
+    SET genres = normalised.genres, version = version + 1
+    FROM normalised
+    WHERE movies.id = normalised.id AND movies.genres IS DISTINCT FROM normalised.genres
+    RETURNING movies.id, movies.title, movies.year, movies.runtime, movies.rating, movies.votes,
+        movies.version, normalised.old_genres, movies.genres
+)
+INSERT INTO movie_revisions (movie_id, version, user_id, action, before, after)
+SELECT changed.id, changed.version, NULL, 'update', before.snapshot, after.snapshot
+FROM changed,
+    LATERAL (SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id', changed.id,
+        'title', changed.title,
+        'year', NULLIF(changed.year, 0),
+        'runtime', CASE WHEN changed.runtime <> 0 THEN changed.runtime || ' mins' END,
+        'genres', CASE WHEN cardinality(changed.old_genres) > 0 THEN changed.old_genres END,
+        'version', changed.version - 1,
+        'rating', changed.rating,
+        'votes', changed.votes
+    )) AS snapshot) AS before,
+    LATERAL (SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id', changed.id,
+        'title', changed.title,
+        'year', NULLIF(changed.year, 0),
+        'runtime', CASE WHEN changed.runtime <> 0 THEN changed.runtime || ' mins' END,
+        'genres', CASE WHEN cardinality(changed.genres) > 0 THEN changed.genres END,
+        'version', changed.version,
+        'rating', changed.rating,
+        'votes', changed.votes
+    )) AS snapshot) AS after;
+
+-- Add the permission required to manage the genre taxonomy, and bundle it into the
+-- admin role.
+INSERT INTO permissions (code)
+VALUES
+    ('genres:write');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'genres:write';
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS movie_images (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    kind text NOT NULL CHECK (kind IN ('poster', 'backdrop')),
+    content_type text NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    CONSTRAINT movie_images_movie_id_kind_key UNIQUE (movie_id, kind)
+);
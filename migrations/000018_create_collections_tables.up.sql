@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS collections (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL UNIQUE,
+    description text NOT NULL DEFAULT '',
+    ordering text NOT NULL DEFAULT 'release' CHECK (ordering IN ('release', 'custom')),
+    version integer NOT NULL DEFAULT 1
+);
+
+-- A movie belongs to at most one collection, so movie_id alone is the key.
+CREATE TABLE IF NOT EXISTS collection_movies (
+    movie_id bigint PRIMARY KEY REFERENCES movies ON DELETE CASCADE,
+    collection_id bigint NOT NULL REFERENCES collections ON DELETE CASCADE,
+    position integer NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS collection_movies_collection_id_idx ON collection_movies (collection_id);
@@ -0,0 +1,14 @@
+-- Alternate titles of a movie, one per language tag such as "fr" or "pt-BR". Each is
+-- searched with the text search configuration for its language, or 'simple' where
+-- Postgres has none, and search_vector is kept up to date by the broker.
+CREATE TABLE IF NOT EXISTS movie_titles (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    language text NOT NULL,
+    title text NOT NULL,
+    search_config regconfig NOT NULL DEFAULT 'simple',
+    search_vector tsvector NOT NULL,
+    CONSTRAINT movie_titles_movie_id_language_key UNIQUE (movie_id, language)
+);
+
+CREATE INDEX IF NOT EXISTS movie_titles_search_vector_idx ON movie_titles USING GIN (search_vector);
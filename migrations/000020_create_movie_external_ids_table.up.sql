@@ -0,0 +1,9 @@
+-- The identifiers other systems use for a movie. An identifier belongs to at most one
+-- movie, and a movie has at most one identifier from each source.
+CREATE TABLE IF NOT EXISTS movie_external_ids (
+    source text NOT NULL CHECK (source IN ('imdb', 'tmdb', 'wikidata')),
+    external_id text NOT NULL,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    PRIMARY KEY (source, external_id),
+    CONSTRAINT movie_external_ids_movie_id_source_key UNIQUE (movie_id, source)
+);
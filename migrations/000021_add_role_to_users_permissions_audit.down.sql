@@ -0,0 +1 @@
+ALTER TABLE users_permissions_audit DROP COLUMN IF EXISTS role;
@@ -0,0 +1,3 @@
+-- Permissions granted or revoked by assigning or unassigning a role are audited
+-- against the name of the role, which is NULL for direct grants and revokes.
+ALTER TABLE users_permissions_audit ADD COLUMN IF NOT EXISTS role text;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS movie_images_token_idx;
+ALTER TABLE movie_images DROP COLUMN IF EXISTS token;
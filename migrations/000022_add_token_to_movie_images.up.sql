@@ -0,0 +1,5 @@
+-- Images are served without authentication, so they are addressed by a random token
+-- rather than by their sequential id, which anyone could walk through. Adding the
+-- column with a volatile default gives every existing image its own token.
+ALTER TABLE movie_images ADD COLUMN IF NOT EXISTS token text NOT NULL DEFAULT replace(gen_random_uuid()::text, '-', '');
+CREATE UNIQUE INDEX IF NOT EXISTS movie_images_token_idx ON movie_images (token);
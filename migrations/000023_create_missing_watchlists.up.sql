@@ -0,0 +1,8 @@
+-- Watchlists used to be created the first time a user listed their lists, and are
+-- now created when the user is activated. Create one for every activated user who
+-- hasn't got one yet.
+INSERT INTO lists (user_id, name, watchlist)
+SELECT id, 'Watchlist', true
+FROM users
+WHERE activated
+ON CONFLICT DO NOTHING;
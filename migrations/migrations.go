@@ -0,0 +1,9 @@
+package migrations
+
+import "embed"
+
+// FS holds every numbered up/down SQL file in this directory so that the
+// greenlight binary can apply them without the files being shipped alongside it.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -18,7 +18,10 @@ import (
 	"golang.org/x/time/rate"
 )
 
-func RateLimit(app app.Application) gin.HandlerFunc {
+// RateLimit limits each client IP to the configured requests per second. Most
+// requests use up one token from the client's bucket, but routes which are more
+// expensive to serve can be given a higher cost, keyed by their route pattern.
+func RateLimit(app app.Application, costs map[string]int) gin.HandlerFunc {
 	// Define a client struct to hold the rate limiter and last seen time for each
 	// client.
 	type client struct {
@@ -73,10 +76,15 @@ func RateLimit(app app.Application) gin.HandlerFunc {
 			// Update the last seen time for the client.
 			clients[ip].lastSeen = time.Now()
 
-			// Call the Allow() method on the rate limiter for the current IP address. If
-			// the request isn't allowed, unlock the mutex and send a 429 Too Many Requests
-			// response, just like before.
-			if !clients[ip].limiter.Allow() {
+			// Call the AllowN() method on the rate limiter for the current IP address,
+			// using up as many tokens as the matched route costs. If the request isn't
+			// allowed, unlock the mutex and send a 429 Too Many Requests response, just
+			// like before.
+			cost, ok := costs[c.FullPath()]
+			if !ok || cost < 1 {
+				cost = 1
+			}
+			if !clients[ip].limiter.AllowN(time.Now(), cost) {
 				mu.Unlock()
 				handlers.ErrorResponse(c, app, handlers.RateLimitExceededError())
 				return
@@ -152,14 +160,36 @@ func Authenticate(app app.Application) gin.HandlerFunc {
 		}
 
 		// Call the contextSetUser() helper to add the user information to the request
-		// context.
+		// context. The plaintext token is stored as well so that handlers can revoke
+		// the token that was presented.
 		c.Set("user", user)
+		c.Set("token", token)
 
 		// Call the next handler in the chain.
 		c.Next()
 	}
 }
 
+func RequireAuthenticated(app app.Application) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userVal, exists := c.Get("user")
+		if !exists {
+			handlers.ErrorResponse(c, app, handlers.AuthenticationRequired())
+			c.Abort()
+			return
+		}
+
+		// Perform a type assertion
+		user, ok := userVal.(*models.User)
+		if !ok || user.IsAnonymous() {
+			handlers.ErrorResponse(c, app, handlers.AuthenticationRequired())
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func RequireActivated(app app.Application) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userVal, exists := c.Get("user")
@@ -231,6 +261,9 @@ func CORS(app app.Application) gin.HandlerFunc {
 					// response header with the request origin as the value and break
 					// out of the loop.
 					c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+					// Let browser clients read the ETag so that they can send it back
+					// in If-Match and If-None-Match headers.
+					c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
 					// Check if the request has the HTTP method OPTIONS and contains the
 					// "Access-Control-Request-Method" header. If it does, then we treat
 					// it as a preflight request.
@@ -238,7 +271,7 @@ func CORS(app app.Application) gin.HandlerFunc {
 						// Set the necessary preflight response headers, as discussed
 						// previously.
 						c.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						c.Writer.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						c.Writer.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match")
 						// Write the headers along with a 200 OK status and return from
 						// the middleware with no further action.
 						c.Writer.WriteHeader(http.StatusOK)
@@ -12,7 +12,12 @@ func NewRouter(a app.Application) *gin.Engine {
 	r := gin.Default()
 	r.NoMethod(MethodNotAllowed(a))
 	r.NoRoute(NotFound(a))
-	r.Use(Metrics(), gin.Recovery(), CORS(a), RateLimit(a), Authenticate(a))
+	// Requests to these routes use up more than one token of the client's rate limit.
+	costs := map[string]int{
+		"/v1/movies/suggest": a.Config.Suggest.RateCost,
+		"/v1/movies/export":  a.Config.Export.RateCost,
+	}
+	r.Use(Metrics(), gin.Recovery(), CORS(a), RateLimit(a, costs), Authenticate(a))
 	v1 := r.Group("/v1")
 	v1.GET("/healthcheck", func(c *gin.Context) {
 		handlers.HealthcheckHandler(c, a)
@@ -35,6 +40,140 @@ func NewRouter(a app.Application) *gin.Engine {
 		movies.GET("", RequirePermission(a, "movies:read"), func(c *gin.Context) {
 			handlers.ListMoviesHandler(c, a)
 		})
+		movies.GET("/suggest", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.SuggestMoviesHandler(c, a)
+		})
+		movies.GET("/lookup", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.LookupMovieHandler(c, a)
+		})
+		movies.GET("/export", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.ExportMoviesHandler(c, a)
+		})
+		movies.POST("/import", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.ImportMoviesHandler(c, a)
+		})
+		movies.GET("/trash", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.ListTrashedMoviesHandler(c, a)
+		})
+		movies.POST("/:id/restore", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.RestoreMovieHandler(c, a)
+		})
+		movies.DELETE("/trash/:id", RequirePermission(a, "movies:purge"), func(c *gin.Context) {
+			handlers.PurgeMovieHandler(c, a)
+		})
+		movies.GET("/:id/titles", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.ListMovieTitlesHandler(c, a)
+		})
+		movies.PUT("/:id/titles/:language", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.SetMovieTitleHandler(c, a)
+		})
+		movies.DELETE("/:id/titles/:language", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.DeleteMovieTitleHandler(c, a)
+		})
+		movies.GET("/:id/images", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.ListMovieImagesHandler(c, a)
+		})
+		movies.PUT("/:id/images/:kind", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.UploadMovieImageHandler(c, a)
+		})
+		movies.DELETE("/:id/images/:kind", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.DeleteMovieImageHandler(c, a)
+		})
+		movies.PUT("/:id/rating", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.RateMovieHandler(c, a)
+		})
+		movies.DELETE("/:id/rating", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.DeleteMovieRatingHandler(c, a)
+		})
+		movies.GET("/:id/reviews", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.ListMovieReviewsHandler(c, a)
+		})
+		movies.POST("/:id/reviews", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.CreateReviewHandler(c, a)
+		})
+		movies.PATCH("/:id/reviews/:review_id", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.UpdateReviewHandler(c, a)
+		})
+		movies.DELETE("/:id/reviews/:review_id", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.DeleteReviewHandler(c, a)
+		})
+		movies.POST("/:id/credits", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.CreateCreditHandler(c, a)
+		})
+		movies.DELETE("/:id/credits/:credit_id", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.DeleteCreditHandler(c, a)
+		})
+		movies.GET("/:id/revisions", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.ListMovieRevisionsHandler(c, a)
+		})
+		movies.POST("/:id/revisions/:version/restore", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.RollbackMovieHandler(c, a)
+		})
+	}
+	people := v1.Group("/people")
+	people.Use(RequireActivated(a))
+	{
+		people.POST("", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.CreatePersonHandler(c, a)
+		})
+		people.GET("/:id", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.ShowPersonHandler(c, a)
+		})
+		people.PATCH("/:id", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.UpdatePersonHandler(c, a)
+		})
+		people.DELETE("/:id", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.DeletePersonHandler(c, a)
+		})
+	}
+	// Image files are linked to from pages and apps which can't send a bearer token,
+	// so they are served without one. They are addressed by a random token which is
+	// only handed out to users who can read the movie.
+	v1.GET("/images/:token/:variant", func(c *gin.Context) {
+		handlers.ServeImageHandler(c, a)
+	})
+
+	collections := v1.Group("/collections")
+	collections.Use(RequireActivated(a))
+	{
+		collections.GET("", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.ListCollectionsHandler(c, a)
+		})
+		collections.POST("", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.CreateCollectionHandler(c, a)
+		})
+		collections.GET("/:id", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.ShowCollectionHandler(c, a)
+		})
+		collections.PATCH("/:id", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.UpdateCollectionHandler(c, a)
+		})
+		collections.DELETE("/:id", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.DeleteCollectionHandler(c, a)
+		})
+		collections.POST("/:id/movies", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.AddCollectionMovieHandler(c, a)
+		})
+		collections.PUT("/:id/movies", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.ReorderCollectionMoviesHandler(c, a)
+		})
+		collections.DELETE("/:id/movies/:movie_id", RequirePermission(a, "movies:write"), func(c *gin.Context) {
+			handlers.DeleteCollectionMovieHandler(c, a)
+		})
+	}
+
+	genres := v1.Group("/genres")
+	genres.Use(RequireActivated(a))
+	{
+		genres.GET("", RequirePermission(a, "movies:read"), func(c *gin.Context) {
+			handlers.ListGenresHandler(c, a)
+		})
+		genres.POST("", RequirePermission(a, "genres:write"), func(c *gin.Context) {
+			handlers.CreateGenreHandler(c, a)
+		})
+		genres.POST("/merge", RequirePermission(a, "genres:write"), func(c *gin.Context) {
+			handlers.MergeGenresHandler(c, a)
+		})
 	}
 	users := v1.Group("/users")
 	{
@@ -44,12 +183,108 @@ func NewRouter(a app.Application) *gin.Engine {
 		users.PUT("/activated", func(c *gin.Context) {
 			handlers.ActivateUserHandler(c, a)
 		})
+		users.PUT("/password", func(c *gin.Context) {
+			handlers.UpdateUserPasswordHandler(c, a)
+		})
+	}
+	userPermissions := users.Group("/:id/permissions")
+	userPermissions.Use(RequireActivated(a), RequirePermission(a, "users:admin"))
+	{
+		userPermissions.GET("", func(c *gin.Context) {
+			handlers.ListUserPermissionsHandler(c, a)
+		})
+		userPermissions.GET("/history", func(c *gin.Context) {
+			handlers.ListUserPermissionHistoryHandler(c, a)
+		})
+		userPermissions.POST("", func(c *gin.Context) {
+			handlers.GrantUserPermissionsHandler(c, a)
+		})
+		userPermissions.DELETE("/:code", func(c *gin.Context) {
+			handlers.RevokeUserPermissionHandler(c, a)
+		})
 	}
 	tokens := v1.Group("/tokens")
 	{
 		tokens.POST("/authentication", func(c *gin.Context) {
 			handlers.AuthenticationTokenHandler(c, a)
 		})
+		tokens.POST("/password-reset", func(c *gin.Context) {
+			handlers.PasswordResetTokenHandler(c, a)
+		})
+		tokens.DELETE("/authentication", RequireAuthenticated(a), func(c *gin.Context) {
+			handlers.RevokeAuthenticationTokenHandler(c, a)
+		})
+		tokens.DELETE("/authentication/all", RequireAuthenticated(a), func(c *gin.Context) {
+			handlers.RevokeAllAuthenticationTokensHandler(c, a)
+		})
+	}
+	roles := v1.Group("/roles")
+	roles.Use(RequireActivated(a), RequirePermission(a, "roles:admin"))
+	{
+		roles.GET("", func(c *gin.Context) {
+			handlers.ListRolesHandler(c, a)
+		})
+		roles.POST("", func(c *gin.Context) {
+			handlers.CreateRoleHandler(c, a)
+		})
+		roles.GET("/:id", func(c *gin.Context) {
+			handlers.ShowRoleHandler(c, a)
+		})
+		roles.PATCH("/:id", func(c *gin.Context) {
+			handlers.UpdateRoleHandler(c, a)
+		})
+		roles.DELETE("/:id", func(c *gin.Context) {
+			handlers.DeleteRoleHandler(c, a)
+		})
+		roles.POST("/:id/users", func(c *gin.Context) {
+			handlers.AssignRoleHandler(c, a)
+		})
+		roles.DELETE("/:id/users/:user_id", func(c *gin.Context) {
+			handlers.UnassignRoleHandler(c, a)
+		})
+	}
+	// Shared lists can be read without an account, so the public route sits outside
+	// the group which requires an activated user.
+	v1.GET("/lists/public/:slug", func(c *gin.Context) {
+		handlers.ShowPublicListHandler(c, a)
+	})
+	lists := v1.Group("/lists")
+	lists.Use(RequireActivated(a))
+	{
+		lists.GET("", func(c *gin.Context) {
+			handlers.ListListsHandler(c, a)
+		})
+		lists.POST("", func(c *gin.Context) {
+			handlers.CreateListHandler(c, a)
+		})
+		lists.GET("/:id", func(c *gin.Context) {
+			handlers.ShowListHandler(c, a)
+		})
+		lists.PATCH("/:id", func(c *gin.Context) {
+			handlers.UpdateListHandler(c, a)
+		})
+		lists.DELETE("/:id", func(c *gin.Context) {
+			handlers.DeleteListHandler(c, a)
+		})
+		lists.POST("/:id/items", func(c *gin.Context) {
+			handlers.AddListItemHandler(c, a)
+		})
+		lists.PUT("/:id/items", func(c *gin.Context) {
+			handlers.ReorderListItemsHandler(c, a)
+		})
+		lists.DELETE("/:id/items/:movie_id", func(c *gin.Context) {
+			handlers.DeleteListItemHandler(c, a)
+		})
+	}
+	reviews := v1.Group("/reviews")
+	reviews.Use(RequireActivated(a), RequirePermission(a, "reviews:moderate"))
+	{
+		reviews.GET("", func(c *gin.Context) {
+			handlers.ListReviewsForModerationHandler(c, a)
+		})
+		reviews.PUT("/:id/status", func(c *gin.Context) {
+			handlers.ModerateReviewHandler(c, a)
+		})
 	}
 	debug := v1.Group("/debug")
 	{
@@ -11,3 +11,9 @@ var _greenlight string
 
 //go:embed text/en/start.md
 var _start string
+
+//go:embed text/en/migrate.md
+var _migrate string
+
+//go:embed text/en/import.md
+var _import string